@@ -0,0 +1,298 @@
+package common
+
+import (
+	"fmt"
+	config "github.com/micro/go-config"
+	"github.com/micro/go-config/reader"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Result is the outcome of evaluating a check against a kubernetes resource.
+type Result struct {
+	Passed bool
+	Reason string
+}
+
+// Check is a single best practice check evaluated against kubernetes
+// resources, given the resource along with the metadata and specification of
+// its pods, and the configuration of the service.
+type Check interface {
+	Name() string
+	Description() string
+	Evaluate(obj interface{}, m meta.ObjectMeta, spec core.PodSpec, cfg config.Config) Result
+}
+
+// Evaluation is the result of a check evaluated against a resource.
+type Evaluation struct {
+	Check  Check
+	Result Result
+}
+
+// CheckFunc is a simple check backed by a function.
+type CheckFunc struct {
+	CheckName        string
+	CheckDescription string
+	Func             func(obj interface{}, m meta.ObjectMeta, spec core.PodSpec, cfg config.Config) Result
+}
+
+// Name returns the name of the check.
+func (c CheckFunc) Name() string {
+	return c.CheckName
+}
+
+// Description returns a short description of what the check verifies.
+func (c CheckFunc) Description() string {
+	return c.CheckDescription
+}
+
+// Evaluate runs the check against the resource.
+func (c CheckFunc) Evaluate(obj interface{}, m meta.ObjectMeta, spec core.PodSpec, cfg config.Config) Result {
+	return c.Func(obj, m, spec, cfg)
+}
+
+// Registry of all checks, in order of registration, along with the names of
+// the checks that are disabled unless explicitly enabled.
+var checks = struct {
+	sync.RWMutex
+	list     []Check
+	optional map[string]bool
+}{optional: map[string]bool{}}
+
+// Kinds of resources the checks can be evaluated against.
+var workloadKinds = map[string]bool{
+	"pod":         true,
+	"deployment":  true,
+	"daemonset":   true,
+	"statefulset": true,
+	"replicaset":  true,
+	"job":         true,
+}
+
+func init() {
+	RegisterCheck(CheckFunc{
+		CheckName:        "observability",
+		CheckDescription: "proof of observability",
+		Func:             observabilityResult,
+	})
+	RegisterCheck(CheckFunc{
+		CheckName:        "liveness",
+		CheckDescription: "proof of liveness",
+		Func: func(_ interface{}, _ meta.ObjectMeta, spec core.PodSpec, _ config.Config) Result {
+			return containerResult(spec, HasLiveness, "has no liveness probe", func(c core.Container) bool {
+				return c.LivenessProbe != nil && hasDefinedHandler(c.LivenessProbe.ProbeHandler)
+			})
+		},
+	})
+	RegisterCheck(CheckFunc{
+		CheckName:        "readiness",
+		CheckDescription: "proof of readiness",
+		Func: func(_ interface{}, _ meta.ObjectMeta, spec core.PodSpec, _ config.Config) Result {
+			return containerResult(spec, HasReadiness, "has no readiness probe", func(c core.Container) bool {
+				return c.ReadinessProbe != nil && hasDefinedHandler(c.ReadinessProbe.ProbeHandler)
+			})
+		},
+	})
+	RegisterCheck(CheckFunc{
+		CheckName:        "requests",
+		CheckDescription: "proof of requests",
+		Func: func(_ interface{}, _ meta.ObjectMeta, spec core.PodSpec, _ config.Config) Result {
+			return containerResult(spec, HasRequests, "is missing cpu or memory requests", func(c core.Container) bool {
+				return hasAllResources(c.Resources.Requests)
+			})
+		},
+	})
+	RegisterCheck(CheckFunc{
+		CheckName:        "limits",
+		CheckDescription: "proof of limits",
+		Func: func(_ interface{}, _ meta.ObjectMeta, spec core.PodSpec, _ config.Config) Result {
+			return containerResult(spec, HasLimits, "is missing cpu or memory limits", func(c core.Container) bool {
+				return hasAllResources(c.Resources.Limits)
+			})
+		},
+	})
+	RegisterOptionalCheck(CheckFunc{
+		CheckName:        "init-requests",
+		CheckDescription: "proof of init container requests",
+		Func: func(_ interface{}, _ meta.ObjectMeta, spec core.PodSpec, _ config.Config) Result {
+			return initContainerResult(spec, "is missing cpu or memory requests", func(c core.Container) bool {
+				return hasAllResources(c.Resources.Requests)
+			})
+		},
+	})
+	RegisterOptionalCheck(CheckFunc{
+		CheckName:        "init-limits",
+		CheckDescription: "proof of init container limits",
+		Func: func(_ interface{}, _ meta.ObjectMeta, spec core.PodSpec, _ config.Config) Result {
+			return initContainerResult(spec, "is missing cpu or memory limits", func(c core.Container) bool {
+				return hasAllResources(c.Resources.Limits)
+			})
+		},
+	})
+}
+
+// RegisterCheck adds the check to the registry, panicking if a check with
+// the same name has already been registered.
+func RegisterCheck(check Check) {
+	checks.Lock()
+	defer checks.Unlock()
+	for _, c := range checks.list {
+		if c.Name() == check.Name() {
+			panic(fmt.Sprintf("check [%s] already registered", check.Name()))
+		}
+	}
+	checks.list = append(checks.list, check)
+}
+
+// RegisterOptionalCheck adds the check to the registry like RegisterCheck,
+// but the check is only evaluated when it is enabled through the
+// configuration or included by a policy.
+func RegisterOptionalCheck(check Check) {
+	RegisterCheck(check)
+	checks.Lock()
+	defer checks.Unlock()
+	checks.optional[check.Name()] = true
+}
+
+// IsOptionalCheck determines whether or not the named check is disabled unless
+// explicitly enabled.
+func IsOptionalCheck(name string) bool {
+	checks.RLock()
+	defer checks.RUnlock()
+	return checks.optional[name]
+}
+
+// IsCheckEnabled determines whether or not the named check is enabled by the
+// configuration, which is the case for all checks but optional ones by default.
+func IsCheckEnabled(name string, cfg config.Config) bool {
+	return GetCheckSetting(cfg, name, "enabled").Bool(!IsOptionalCheck(name))
+}
+
+// IsCheckSuppressing determines whether or not failing the named check gets a
+// resource suppressed, which is the case for all checks but optional ones by
+// default, so that enabling an optional check only reports its failures.
+func IsCheckSuppressing(name string, cfg config.Config) bool {
+	return GetCheckSetting(cfg, name, "suppress").Bool(!IsOptionalCheck(name))
+}
+
+// GetCheckSetting returns the configuration value of the named check under the
+// given key. Hyphens in the name of the check separate configuration sections,
+// so that e.g. the "enabled" key of the "probe-timeout" check is read from
+// SOLSKIN_CHECKS_PROBE_TIMEOUT_ENABLED.
+func GetCheckSetting(cfg config.Config, name string, key ...string) reader.Value {
+	path := append([]string{"checks"}, strings.Split(name, "-")...)
+	return cfg.Get(append(path, key...)...)
+}
+
+// GetChecks returns all registered checks, in order of registration.
+func GetChecks() []Check {
+	checks.RLock()
+	defer checks.RUnlock()
+	return append([]Check{}, checks.list...)
+}
+
+// EvaluateChecks runs every registered check that is included against the
+// resource.
+func EvaluateChecks(obj interface{}, cfg config.Config, include func(string) bool) []Evaluation {
+	evaluations := []Evaluation{}
+	if _, ktype := GetObjectMeta(obj); !workloadKinds[ktype] {
+		return evaluations
+	}
+
+	m := GetPodTemplateMeta(obj)
+	spec := GetPodSpec(obj)
+	for _, check := range GetChecks() {
+		if !include(check.Name()) {
+			continue
+		}
+		evaluations = append(evaluations, Evaluation{
+			Check:  check,
+			Result: check.Evaluate(obj, m, withoutIgnoredContainers(*spec, check.Name(), cfg), cfg),
+		})
+	}
+	return evaluations
+}
+
+// IsContainerIgnored determines whether or not the named container is left out
+// of the named check, because its name fully matches one of the comma
+// separated regular expressions configured for the check.
+func IsContainerIgnored(cfg config.Config, check string, container string) bool {
+	patterns := GetCheckSetting(cfg, check, "ignore", "containers").String("")
+	for _, pattern := range strings.Split(patterns, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+
+		match, err := regexp.MatchString("^(?:"+pattern+")$", container)
+		if err != nil {
+			log.Printf("could not parse %s container pattern, value given: [%s]", check, pattern)
+			continue
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// Helper function to copy the spec, leaving out the containers and init
+// containers ignored by the named check.
+func withoutIgnoredContainers(spec core.PodSpec, check string, cfg config.Config) core.PodSpec {
+	filter := func(containers []core.Container) []core.Container {
+		kept := []core.Container{}
+		for _, container := range containers {
+			if !IsContainerIgnored(cfg, check, container.Name) {
+				kept = append(kept, container)
+			}
+		}
+		return kept
+	}
+
+	spec.Containers = filter(spec.Containers)
+	spec.InitContainers = filter(spec.InitContainers)
+	return spec
+}
+
+// Helper function to build the result of a check evaluated per container,
+// naming the first container that fails the check.
+func containerResult(spec core.PodSpec, check func(core.PodSpec) bool, reason string, passes func(core.Container) bool) Result {
+	if check(spec) {
+		return Result{Passed: true}
+	}
+
+	for _, container := range spec.Containers {
+		if !passes(container) {
+			return Result{Reason: fmt.Sprintf("container [%s] %s", container.Name, reason)}
+		}
+	}
+	return Result{Reason: "no containers defined"}
+}
+
+// Helper function to build the result of a check evaluated per container,
+// where the check returns the problem with a container, if any, and naming the
+// first container with a problem.
+func firstProblem(spec core.PodSpec, problem func(core.Container) string) Result {
+	for _, container := range spec.Containers {
+		if reason := problem(container); reason != "" {
+			return Result{Reason: fmt.Sprintf("container [%s] %s", container.Name, reason)}
+		}
+	}
+	return Result{Passed: true}
+}
+
+// Helper function to build the result of a check evaluated per init
+// container, naming the first init container that fails the check. Pods
+// without init containers pass.
+func initContainerResult(spec core.PodSpec, reason string, passes func(core.Container) bool) Result {
+	for _, container := range spec.InitContainers {
+		if !passes(container) {
+			return Result{Reason: fmt.Sprintf("init container [%s] %s", container.Name, reason)}
+		}
+	}
+	return Result{Passed: true}
+}
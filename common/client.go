@@ -0,0 +1,169 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcore "k8s.io/client-go/kubernetes/typed/core/v1"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// EventSource is the component name attached to every kubernetes event we
+// emit.
+const EventSource = "solskin"
+
+// Recorder of the kubernetes events we emit, which drops every event until a
+// recorder is set.
+var recorder record.EventRecorder = &record.FakeRecorder{}
+
+// PatchAnnotations will set the given annotations on the kubernetes resource,
+// an empty value removes the annotation from the resource.
+func PatchAnnotations(client kubernetes.Interface, obj interface{}, annotations map[string]string) error {
+	values := make(map[string]interface{}, len(annotations))
+	for k, v := range annotations {
+		if v == "" {
+			values[k] = nil
+			continue
+		}
+		values[k] = v
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": values,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	m, ktype := GetObjectMeta(obj)
+	name, ns := m.GetName(), m.GetNamespace()
+	pt := types.StrategicMergePatchType
+	switch ktype {
+	case "pod":
+		_, err = client.CoreV1().Pods(ns).Patch(context.TODO(), name, pt, data, meta.PatchOptions{})
+	case "deployment":
+		_, err = client.AppsV1().Deployments(ns).Patch(context.TODO(), name, pt, data, meta.PatchOptions{})
+	case "daemonset":
+		_, err = client.AppsV1().DaemonSets(ns).Patch(context.TODO(), name, pt, data, meta.PatchOptions{})
+	case "statefulset":
+		_, err = client.AppsV1().StatefulSets(ns).Patch(context.TODO(), name, pt, data, meta.PatchOptions{})
+	case "replicaset":
+		_, err = client.AppsV1().ReplicaSets(ns).Patch(context.TODO(), name, pt, data, meta.PatchOptions{})
+	case "job":
+		_, err = client.BatchV1().Jobs(ns).Patch(context.TODO(), name, pt, data, meta.PatchOptions{})
+	default:
+		err = fmt.Errorf("cannot patch resource of type [%s]", ktype)
+	}
+	return err
+}
+
+// NewEventRecorder creates a recorder posting kubernetes events through the
+// given client, which aggregates repeated events into a single event with a
+// count and rate limits the events of every resource.
+func NewEventRecorder(client kubernetes.Interface) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcore.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	return broadcaster.NewRecorder(scheme.Scheme, core.EventSource{Component: EventSource})
+}
+
+// SetEventRecorder sets the recorder used to post kubernetes events.
+func SetEventRecorder(r record.EventRecorder) {
+	recorder = r
+}
+
+// RecordEventWithOwner will record an event on the given resource and, for
+// pods, on the top-level workload that owns the pod so that the event is
+// visible where the owners of the workload will look for it.
+func RecordEventWithOwner(obj interface{}, etype, reason, message string) error {
+	recorder.Event(obj.(runtime.Object), etype, reason, message)
+
+	_, ktype := GetObjectMeta(obj)
+	if ktype != "pod" {
+		return nil
+	}
+
+	owner, err := GetRootOwner(obj)
+	if err != nil || owner == obj {
+		return err
+	}
+
+	message = fmt.Sprintf("Pod %s: %s", GetFullLabel(obj), message)
+	recorder.Event(owner.(runtime.Object), etype, reason, message)
+	return nil
+}
+
+// Listers of the resources that can own other resources, used to look up the
+// owners of resources from the informer caches rather than the API server.
+var owners struct {
+	replicaSets  appslisters.ReplicaSetLister
+	deployments  appslisters.DeploymentLister
+	daemonSets   appslisters.DaemonSetLister
+	statefulSets appslisters.StatefulSetLister
+	jobs         batchlisters.JobLister
+}
+
+// SetOwnerListers registers the informers of the resources that can own other
+// resources with the given factory, and looks up owners through their listers.
+// The informers need to be running and synced before any owner is looked up.
+func SetOwnerListers(factory informers.SharedInformerFactory) {
+	owners.replicaSets = factory.Apps().V1().ReplicaSets().Lister()
+	owners.deployments = factory.Apps().V1().Deployments().Lister()
+	owners.daemonSets = factory.Apps().V1().DaemonSets().Lister()
+	owners.statefulSets = factory.Apps().V1().StatefulSets().Lister()
+	owners.jobs = factory.Batch().V1().Jobs().Lister()
+}
+
+// GetOwner returns the resource that controls the given resource, or nil if
+// the resource has no controller we know how to handle.
+func GetOwner(obj interface{}) (interface{}, error) {
+	m, _ := GetObjectMeta(obj)
+	ref := meta.GetControllerOf(&m)
+	if ref == nil {
+		return nil, nil
+	}
+	if owners.replicaSets == nil {
+		return nil, fmt.Errorf("owner listers have not been set")
+	}
+
+	ns := m.GetNamespace()
+	switch ref.Kind {
+	case "ReplicaSet":
+		return owners.replicaSets.ReplicaSets(ns).Get(ref.Name)
+	case "Deployment":
+		return owners.deployments.Deployments(ns).Get(ref.Name)
+	case "DaemonSet":
+		return owners.daemonSets.DaemonSets(ns).Get(ref.Name)
+	case "StatefulSet":
+		return owners.statefulSets.StatefulSets(ns).Get(ref.Name)
+	case "Job":
+		return owners.jobs.Jobs(ns).Get(ref.Name)
+	}
+	return nil, nil
+}
+
+// GetRootOwner walks up the controllers of the given resource and returns the
+// top-level one, which is the resource itself if it has no controller.
+func GetRootOwner(obj interface{}) (interface{}, error) {
+	root := obj
+	for {
+		owner, err := GetOwner(root)
+		if err != nil {
+			return nil, err
+		}
+		if owner == nil {
+			return root, nil
+		}
+		root = owner
+	}
+}
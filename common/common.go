@@ -10,6 +10,7 @@ import (
 	"log"
 	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -27,6 +28,8 @@ func GetPodSpec(obj interface{}) *core.PodSpec {
 		return &obj.(*apps.DaemonSet).Spec.Template.Spec
 	case "statefulset":
 		return &obj.(*apps.StatefulSet).Spec.Template.Spec
+	case "replicaset":
+		return &obj.(*apps.ReplicaSet).Spec.Template.Spec
 	case "job":
 		return &obj.(*batch.Job).Spec.Template.Spec
 	}
@@ -40,6 +43,12 @@ func IsEligible(obj interface{}, cfg config.Config) bool {
 	// Grab the object's metadata.
 	m, ktype := GetObjectMeta(obj)
 
+	// Resources can opt out of all checks through their annotations.
+	if IsExempt(obj, cfg) {
+		log.Printf("[%s] resource is exempt", GetFullLabel(obj))
+		return false
+	}
+
 	// If we have a pod, skip the age check.
 	if ktype != "pod" {
 		// Test to see if the resource is eligible based on age.
@@ -50,11 +59,27 @@ func IsEligible(obj interface{}, cfg config.Config) bool {
 		}
 	}
 
+	return IsEligibleNamespace(m.Namespace, cfg)
+}
+
+// IsEligibleNamespace determines whether or not resources in the namespace are
+// eligible for monitoring and suppression based on the given configuration.
+func IsEligibleNamespace(namespace string, cfg config.Config) bool {
+	// Namespaces can explicitly opt in or out through their labels.
+	if enabled, ok := GetNamespaceSetting(namespace, NamespaceEnabledLabel); ok {
+		return enabled == "true"
+	}
+
+	// When namespaces have to opt in, all others are ineligible.
+	if cfg.Get("eligibility", "namespace", "optin").Bool(false) {
+		return false
+	}
+
 	// Extract the pattern from the service configuration.
 	p := cfg.Get("eligibility", "exclude", "namespace").String("^kube-")
 
 	// Run the regexp against the namespace of the resource.
-	match, err := regexp.MatchString(p, m.Namespace)
+	match, err := regexp.MatchString(p, namespace)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -116,9 +141,51 @@ func PassesChecks(checks []bool) bool {
 	return true
 }
 
+// Annotations prometheus uses to discover the pods to scrape.
+const (
+	ScrapeAnnotation = "prometheus.io/scrape"
+	PortAnnotation   = "prometheus.io/port"
+)
+
 // HasObservability determines if a kubernetes resource is observable.
 func HasObservability(objectMeta meta.ObjectMeta) bool {
-	return hasAnnotation(objectMeta, "prometheus.io/scrape")
+	return objectMeta.GetAnnotations()[ScrapeAnnotation] == "true"
+}
+
+// HasDeclaredPort determines if the port, given by number or name, is
+// declared by one of the containers of the spec.
+func HasDeclaredPort(spec core.PodSpec, port string) bool {
+	for _, container := range spec.Containers {
+		for _, p := range container.Ports {
+			if p.Name == port || strconv.Itoa(int(p.ContainerPort)) == port {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Helper function to evaluate the observability of a resource, which is proven
+// either by a monitor scraping its pods or by prometheus annotations
+// scraping a declared port.
+func observabilityResult(obj interface{}, m meta.ObjectMeta, spec core.PodSpec, _ config.Config) Result {
+	om, _ := GetObjectMeta(obj)
+	if _, ok := FindMonitor(om.GetNamespace(), m.GetLabels()); ok {
+		return Result{Passed: true}
+	}
+
+	scrape, ok := m.GetAnnotations()[ScrapeAnnotation]
+	if !ok {
+		return Result{Reason: fmt.Sprintf("missing %s annotation", ScrapeAnnotation)}
+	}
+	if !HasObservability(m) {
+		return Result{Reason: fmt.Sprintf("%s annotation is [%s] rather than [true]", ScrapeAnnotation, scrape)}
+	}
+
+	if port, ok := m.GetAnnotations()[PortAnnotation]; ok && !HasDeclaredPort(spec, port) {
+		return Result{Reason: fmt.Sprintf("%s annotation [%s] is not a port declared by any container", PortAnnotation, port)}
+	}
+	return Result{Passed: true}
 }
 
 // HasLiveness determines if the spec has proper liveness probes.
@@ -133,7 +200,7 @@ func HasLiveness(spec core.PodSpec) bool {
 			return false
 		}
 
-		h := probe.Handler
+		h := probe.ProbeHandler
 		if !hasDefinedHandler(h) {
 			return false
 		}
@@ -153,7 +220,7 @@ func HasReadiness(spec core.PodSpec) bool {
 			return false
 		}
 
-		h := probe.Handler
+		h := probe.ProbeHandler
 		if !hasDefinedHandler(h) {
 			return false
 		}
@@ -161,7 +228,7 @@ func HasReadiness(spec core.PodSpec) bool {
 	return true
 }
 
-func hasDefinedHandler(h core.Handler) bool {
+func hasDefinedHandler(h core.ProbeHandler) bool {
 	if h.Exec != nil {
 		return true
 	}
@@ -171,6 +238,9 @@ func hasDefinedHandler(h core.Handler) bool {
 	if h.TCPSocket != nil {
 		return true
 	}
+	if h.GRPC != nil {
+		return true
+	}
 	return false
 }
 
@@ -227,19 +297,6 @@ func GetObjectMeta(obj interface{}) (meta.ObjectMeta, string) {
 	return objectMeta, strings.ToLower(v.Type().Name())
 }
 
-// Helper function to determine is a given annotation exists in the object's
-// metadata.
-func hasAnnotation(objectMeta meta.ObjectMeta, annotation string) bool {
-	annotations := objectMeta.GetAnnotations()
-	for key := range annotations {
-		if key == annotation {
-			return true
-		}
-	}
-
-	return false
-}
-
 // BooleanToFloat64 is a helper function to convert a boolean value into a
 // float64.
 func BooleanToFloat64(value bool) float64 {
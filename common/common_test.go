@@ -1,6 +1,7 @@
 package common
 
 import (
+	"context"
 	config "github.com/micro/go-config"
 	"github.com/micro/go-config/source/env"
 	"github.com/stretchr/testify/assert"
@@ -9,6 +10,12 @@ import (
 	core "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
 	"os"
 	"testing"
 	"time"
@@ -234,7 +241,7 @@ func TestHasObservability(t *testing.T) {
 			ObjectMeta: meta.ObjectMeta{},
 		},
 		ObjectMetaTest{
-			Expected: true,
+			Expected: false,
 			ObjectMeta: meta.ObjectMeta{
 				Annotations: map[string]string{
 					"prometheus.io/scrape": "false",
@@ -257,6 +264,98 @@ func TestHasObservability(t *testing.T) {
 	}
 }
 
+func TestObservabilityResult(t *testing.T) {
+	spec := core.PodSpec{
+		Containers: []core.Container{
+			core.Container{
+				Name:  "app",
+				Ports: []core.ContainerPort{core.ContainerPort{Name: "metrics", ContainerPort: 9090}},
+			},
+		},
+	}
+
+	type Test struct {
+		Expected    Result
+		Annotations map[string]string
+		Labels      map[string]string
+	}
+
+	tests := []Test{
+		Test{
+			Expected: Result{Reason: "missing prometheus.io/scrape annotation"},
+		},
+		Test{
+			Expected:    Result{Reason: "prometheus.io/scrape annotation is [false] rather than [true]"},
+			Annotations: map[string]string{ScrapeAnnotation: "false"},
+		},
+		Test{
+			Expected:    Result{Passed: true},
+			Annotations: map[string]string{ScrapeAnnotation: "true"},
+		},
+		Test{
+			Expected:    Result{Passed: true},
+			Annotations: map[string]string{ScrapeAnnotation: "true", PortAnnotation: "9090"},
+		},
+		Test{
+			Expected:    Result{Passed: true},
+			Annotations: map[string]string{ScrapeAnnotation: "true", PortAnnotation: "metrics"},
+		},
+		Test{
+			Expected:    Result{Reason: "prometheus.io/port annotation [8080] is not a port declared by any container"},
+			Annotations: map[string]string{ScrapeAnnotation: "true", PortAnnotation: "8080"},
+		},
+
+		// Pods scraped by a pod monitor.
+		Test{
+			Expected: Result{Passed: true},
+			Labels:   map[string]string{"app": "scraped"},
+		},
+
+		// Pods scraped by a service monitor through their service.
+		Test{
+			Expected: Result{Passed: true},
+			Labels:   map[string]string{"app": "web", "tier": "frontend"},
+		},
+	}
+
+	pods := Monitor{
+		Kind:      KindPodMonitor,
+		Name:      "pods",
+		Namespace: "default",
+		Selector:  labels.SelectorFromSet(labels.Set{"app": "scraped"}),
+	}
+	services := Monitor{
+		Kind:         KindServiceMonitor,
+		Name:         "services",
+		Namespace:    "monitoring",
+		Selector:     labels.SelectorFromSet(labels.Set{"monitored": "true"}),
+		AnyNamespace: true,
+	}
+	svc := &core.Service{
+		ObjectMeta: meta.ObjectMeta{Name: "web", Namespace: "default", Labels: map[string]string{"monitored": "true"}},
+		Spec:       core.ServiceSpec{Selector: map[string]string{"app": "web"}},
+	}
+	SetMonitor(pods)
+	SetMonitor(services)
+	SetService(svc)
+	defer DeleteMonitor(pods.Kind, pods.Namespace, pods.Name)
+	defer DeleteMonitor(services.Kind, services.Namespace, services.Name)
+	defer DeleteService(svc)
+
+	for _, test := range tests {
+		pod := &core.Pod{
+			ObjectMeta: meta.ObjectMeta{Namespace: "default", Annotations: test.Annotations, Labels: test.Labels},
+			Spec:       spec,
+		}
+		actual := observabilityResult(pod, pod.ObjectMeta, pod.Spec, config.NewConfig())
+		assert.Exactly(t, test.Expected, actual)
+	}
+
+	// Pod monitors only watch their own namespace by default.
+	pod := &core.Pod{ObjectMeta: meta.ObjectMeta{Namespace: "other", Labels: map[string]string{"app": "scraped"}}}
+	assert.False(t, observabilityResult(pod, pod.ObjectMeta, spec, config.NewConfig()).Passed)
+}
+
 func TestHasLiveness(t *testing.T) {
 	tests := []SpecTest{
 		// Basic test with exec liveness probe.
@@ -266,7 +365,7 @@ func TestHasLiveness(t *testing.T) {
 				Containers: []core.Container{
 					core.Container{
 						LivenessProbe: &core.Probe{
-							Handler: core.Handler{
+							ProbeHandler: core.ProbeHandler{
 								Exec: &core.ExecAction{},
 							},
 						},
@@ -282,7 +381,7 @@ func TestHasLiveness(t *testing.T) {
 				Containers: []core.Container{
 					core.Container{
 						LivenessProbe: &core.Probe{
-							Handler: core.Handler{
+							ProbeHandler: core.ProbeHandler{
 								HTTPGet: &core.HTTPGetAction{},
 							},
 						},
@@ -298,7 +397,7 @@ func TestHasLiveness(t *testing.T) {
 				Containers: []core.Container{
 					core.Container{
 						LivenessProbe: &core.Probe{
-							Handler: core.Handler{
+							ProbeHandler: core.ProbeHandler{
 								TCPSocket: &core.TCPSocketAction{},
 							},
 						},
@@ -307,6 +406,22 @@ func TestHasLiveness(t *testing.T) {
 			},
 		},
 
+		// Basic test with gRPC liveness probe.
+		SpecTest{
+			Expected: true,
+			Spec: core.PodSpec{
+				Containers: []core.Container{
+					core.Container{
+						LivenessProbe: &core.Probe{
+							ProbeHandler: core.ProbeHandler{
+								GRPC: &core.GRPCAction{Port: 9090},
+							},
+						},
+					},
+				},
+			},
+		},
+
 		// Basic test with no liveness probe.
 		SpecTest{
 			Expected: false,
@@ -329,7 +444,7 @@ func TestHasLiveness(t *testing.T) {
 					},
 					core.Container{
 						LivenessProbe: &core.Probe{
-							Handler: core.Handler{
+							ProbeHandler: core.ProbeHandler{
 								Exec: &core.ExecAction{},
 							},
 						},
@@ -345,14 +460,14 @@ func TestHasLiveness(t *testing.T) {
 				Containers: []core.Container{
 					core.Container{
 						LivenessProbe: &core.Probe{
-							Handler: core.Handler{
+							ProbeHandler: core.ProbeHandler{
 								Exec: &core.ExecAction{},
 							},
 						},
 					},
 					core.Container{
 						LivenessProbe: &core.Probe{
-							Handler: core.Handler{
+							ProbeHandler: core.ProbeHandler{
 								Exec: &core.ExecAction{},
 							},
 						},
@@ -377,7 +492,7 @@ func TestHasReadiness(t *testing.T) {
 				Containers: []core.Container{
 					core.Container{
 						ReadinessProbe: &core.Probe{
-							Handler: core.Handler{
+							ProbeHandler: core.ProbeHandler{
 								Exec: &core.ExecAction{},
 							},
 						},
@@ -393,7 +508,7 @@ func TestHasReadiness(t *testing.T) {
 				Containers: []core.Container{
 					core.Container{
 						ReadinessProbe: &core.Probe{
-							Handler: core.Handler{
+							ProbeHandler: core.ProbeHandler{
 								HTTPGet: &core.HTTPGetAction{},
 							},
 						},
@@ -409,7 +524,7 @@ func TestHasReadiness(t *testing.T) {
 				Containers: []core.Container{
 					core.Container{
 						ReadinessProbe: &core.Probe{
-							Handler: core.Handler{
+							ProbeHandler: core.ProbeHandler{
 								TCPSocket: &core.TCPSocketAction{},
 							},
 						},
@@ -440,7 +555,7 @@ func TestHasReadiness(t *testing.T) {
 					},
 					core.Container{
 						ReadinessProbe: &core.Probe{
-							Handler: core.Handler{
+							ProbeHandler: core.ProbeHandler{
 								Exec: &core.ExecAction{},
 							},
 						},
@@ -456,14 +571,14 @@ func TestHasReadiness(t *testing.T) {
 				Containers: []core.Container{
 					core.Container{
 						ReadinessProbe: &core.Probe{
-							Handler: core.Handler{
+							ProbeHandler: core.ProbeHandler{
 								Exec: &core.ExecAction{},
 							},
 						},
 					},
 					core.Container{
 						ReadinessProbe: &core.Probe{
-							Handler: core.Handler{
+							ProbeHandler: core.ProbeHandler{
 								Exec: &core.ExecAction{},
 							},
 						},
@@ -622,3 +737,657 @@ func TestHasRequests(t *testing.T) {
 		assert.Exactly(t, test.Expected, actual)
 	}
 }
+
+func TestPatchAnnotations(t *testing.T) {
+	pod := &core.Pod{
+		ObjectMeta: meta.ObjectMeta{
+			Name:      "test",
+			Namespace: "default",
+			Annotations: map[string]string{
+				"keep": "me",
+			},
+		},
+	}
+	client := fake.NewSimpleClientset(pod)
+
+	err := PatchAnnotations(client, pod, map[string]string{
+		"add": "me",
+	})
+	assert.NoError(t, err)
+
+	actual, err := client.CoreV1().Pods("default").Get(context.TODO(), "test", meta.GetOptions{})
+	assert.NoError(t, err)
+	assert.Exactly(t, "me", actual.GetAnnotations()["add"])
+	assert.Exactly(t, "me", actual.GetAnnotations()["keep"])
+
+	// Patching an unsupported resource type should fail.
+	err = PatchAnnotations(client, &core.Namespace{}, map[string]string{"add": "me"})
+	assert.Error(t, err)
+}
+
+func TestRecordEventWithOwner(t *testing.T) {
+	controller := true
+	dpl := &apps.Deployment{
+		ObjectMeta: meta.ObjectMeta{Name: "dpl", Namespace: "default", UID: "dpl"},
+	}
+	rs := &apps.ReplicaSet{
+		ObjectMeta: meta.ObjectMeta{
+			Name:      "dpl-1234",
+			Namespace: "default",
+			UID:       "rs",
+			OwnerReferences: []meta.OwnerReference{
+				meta.OwnerReference{Kind: "Deployment", Name: "dpl", Controller: &controller},
+			},
+		},
+	}
+	pod := &core.Pod{
+		ObjectMeta: meta.ObjectMeta{
+			Name:      "dpl-1234-abcd",
+			Namespace: "default",
+			UID:       "pod",
+			OwnerReferences: []meta.OwnerReference{
+				meta.OwnerReference{Kind: "ReplicaSet", Name: "dpl-1234", Controller: &controller},
+			},
+		},
+	}
+	client := fake.NewSimpleClientset(dpl, rs, pod)
+	setOwnerListers(t, client)
+
+	// The root owner of the pod should be the deployment.
+	owner, err := GetRootOwner(pod)
+	assert.NoError(t, err)
+	assert.Exactly(t, "deployment:dpl.default", GetFullLabel(owner))
+
+	// The event should be recorded on both the pod and the deployment.
+	recorder := record.NewFakeRecorder(10)
+	SetEventRecorder(recorder)
+	defer SetEventRecorder(&record.FakeRecorder{})
+	assert.NoError(t, RecordEventWithOwner(pod, core.EventTypeWarning, "Test", "test"))
+	assert.Len(t, recorder.Events, 2)
+	assert.Exactly(t, "Warning Test test", <-recorder.Events)
+	assert.Exactly(t, "Warning Test Pod pod:dpl-1234-abcd.default: test", <-recorder.Events)
+}
+
+// Helper function to look up owners through synced informers over the client.
+func setOwnerListers(t *testing.T, client kubernetes.Interface) {
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+
+	factory := informers.NewSharedInformerFactory(client, 0)
+	SetOwnerListers(factory)
+	factory.Start(stop)
+	factory.WaitForCacheSync(stop)
+}
+
+func TestExemptions(t *testing.T) {
+	type Test struct {
+		Expected     bool
+		ExpectedSkip []string
+		Resource     interface{}
+	}
+
+	os.Setenv("SOLSKIN_ELIGIBILITY_EXEMPT_REASON_REQUIRED", "true")
+	defer os.Unsetenv("SOLSKIN_ELIGIBILITY_EXEMPT_REASON_REQUIRED")
+	cfg := config.NewConfig()
+	cfg.Load(env.NewSource(env.WithStrippedPrefix("SOLSKIN")))
+
+	tests := []Test{
+		// No exemption at all.
+		Test{
+			Expected:     false,
+			ExpectedSkip: []string{},
+			Resource:     &core.Pod{},
+		},
+
+		// Exemption without a reason.
+		Test{
+			Expected:     false,
+			ExpectedSkip: []string{},
+			Resource: &core.Pod{
+				ObjectMeta: meta.ObjectMeta{
+					Annotations: map[string]string{
+						ExemptAnnotation:     "true",
+						SkipChecksAnnotation: "liveness",
+					},
+				},
+			},
+		},
+
+		// Exemption with a reason on the pod template.
+		Test{
+			Expected:     true,
+			ExpectedSkip: []string{"liveness", "observability"},
+			Resource: &apps.Deployment{
+				Spec: apps.DeploymentSpec{
+					Template: core.PodTemplateSpec{
+						ObjectMeta: meta.ObjectMeta{
+							Annotations: map[string]string{
+								ExemptAnnotation:       "true",
+								ExemptReasonAnnotation: "batch workload",
+								SkipChecksAnnotation:   "liveness, observability",
+							},
+						},
+					},
+				},
+			},
+		},
+
+		// Expired exemption.
+		Test{
+			Expected:     false,
+			ExpectedSkip: []string{},
+			Resource: &core.Pod{
+				ObjectMeta: meta.ObjectMeta{
+					Annotations: map[string]string{
+						ExemptAnnotation:       "true",
+						ExemptReasonAnnotation: "legacy",
+						ExemptUntilAnnotation:  "2000-01-01",
+						SkipChecksAnnotation:   "liveness",
+					},
+				},
+			},
+		},
+
+		// Exemption that has yet to expire.
+		Test{
+			Expected:     true,
+			ExpectedSkip: []string{},
+			Resource: &core.Pod{
+				ObjectMeta: meta.ObjectMeta{
+					Annotations: map[string]string{
+						ExemptAnnotation:       "true",
+						ExemptReasonAnnotation: "legacy",
+						ExemptUntilAnnotation:  time.Now().Add(24 * time.Hour).Format(time.RFC3339),
+					},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		assert.Exactly(t, test.Expected, IsExempt(test.Resource, cfg))
+		assert.Exactly(t, test.ExpectedSkip, GetSkippedChecks(test.Resource, cfg))
+	}
+}
+
+func TestNamespaceEligibility(t *testing.T) {
+	SetNamespace(&core.Namespace{ObjectMeta: meta.ObjectMeta{
+		Name:   "kube-opted-in",
+		Labels: map[string]string{NamespaceEnabledLabel: "true"},
+	}})
+	SetNamespace(&core.Namespace{ObjectMeta: meta.ObjectMeta{
+		Name:        "opted-out",
+		Annotations: map[string]string{NamespaceEnabledLabel: "false"},
+	}})
+	defer DeleteNamespace("kube-opted-in")
+	defer DeleteNamespace("opted-out")
+
+	pod := func(namespace string) *core.Pod {
+		return &core.Pod{ObjectMeta: meta.ObjectMeta{Namespace: namespace}}
+	}
+
+	// Namespace labels take precedence over the exclusion pattern.
+	cfg := config.NewConfig()
+	assert.True(t, IsEligible(pod("kube-opted-in"), cfg))
+	assert.False(t, IsEligible(pod("opted-out"), cfg))
+	assert.True(t, IsEligible(pod("default"), cfg))
+
+	// When namespaces have to opt in, only opted in namespaces are eligible.
+	os.Setenv("SOLSKIN_ELIGIBILITY_NAMESPACE_OPTIN", "true")
+	defer os.Unsetenv("SOLSKIN_ELIGIBILITY_NAMESPACE_OPTIN")
+	cfg.Load(env.NewSource(env.WithStrippedPrefix("SOLSKIN")))
+	assert.True(t, IsEligible(pod("kube-opted-in"), cfg))
+	assert.False(t, IsEligible(pod("default"), cfg))
+}
+
+func TestCheckRegistry(t *testing.T) {
+	// Restore the registry once we're done.
+	original := GetChecks()
+	defer func() { checks.list = original }()
+
+	custom := CheckFunc{
+		CheckName:        "hostname",
+		CheckDescription: "proof of hostname",
+		Func: func(_ interface{}, _ meta.ObjectMeta, spec core.PodSpec, _ config.Config) Result {
+			return Result{Passed: spec.Hostname != "", Reason: "no hostname"}
+		},
+	}
+	RegisterCheck(custom)
+	assert.Panics(t, func() { RegisterCheck(custom) })
+
+	pod := &core.Pod{
+		Spec: core.PodSpec{
+			Containers: []core.Container{
+				core.Container{Name: "app"},
+			},
+		},
+	}
+
+	cfg := config.NewConfig()
+	include := func(check string) bool { return check != "observability" && IsCheckEnabled(check, cfg) }
+	evaluations := EvaluateChecks(pod, cfg, include)
+
+	names := []string{}
+	reasons := []string{}
+	for _, evaluation := range evaluations {
+		assert.False(t, evaluation.Result.Passed)
+		names = append(names, evaluation.Check.Name())
+		reasons = append(reasons, evaluation.Result.Reason)
+	}
+	assert.Exactly(t, []string{"liveness", "readiness", "requests", "limits", "hostname"}, names)
+	assert.Exactly(t, "container [app] has no liveness probe", reasons[0])
+	assert.Exactly(t, "no hostname", reasons[4])
+
+	// Resources without pods are never evaluated.
+	assert.Empty(t, EvaluateChecks(&core.Namespace{}, cfg, include))
+}
+
+func TestProbeChecks(t *testing.T) {
+	probe := func(port intstr.IntOrString, timeout int32, period int32, delay int32) *core.Probe {
+		return &core.Probe{
+			ProbeHandler:        core.ProbeHandler{HTTPGet: &core.HTTPGetAction{Path: "/health", Port: port}},
+			TimeoutSeconds:      timeout,
+			PeriodSeconds:       period,
+			InitialDelaySeconds: delay,
+		}
+	}
+
+	type Test struct {
+		Check     string
+		Expected  Result
+		Container core.Container
+	}
+
+	ports := []core.ContainerPort{core.ContainerPort{Name: "http", ContainerPort: 8080}}
+	tests := []Test{
+		Test{
+			Check:    "probe-distinct",
+			Expected: Result{Reason: "container [app] has identical liveness and readiness probes"},
+			Container: core.Container{
+				LivenessProbe:  probe(intstr.FromInt(8080), 0, 0, 5),
+				ReadinessProbe: probe(intstr.FromInt(8080), 0, 0, 5),
+			},
+		},
+		Test{
+			Check:    "probe-distinct",
+			Expected: Result{Passed: true},
+			Container: core.Container{
+				LivenessProbe:  probe(intstr.FromInt(8080), 0, 0, 5),
+				ReadinessProbe: probe(intstr.FromInt(8080), 0, 0, 0),
+			},
+		},
+		Test{
+			Check:    "probe-port",
+			Expected: Result{Passed: true},
+			Container: core.Container{
+				Ports:          ports,
+				LivenessProbe:  probe(intstr.FromInt(8080), 0, 0, 5),
+				ReadinessProbe: probe(intstr.FromString("http"), 0, 0, 0),
+			},
+		},
+		Test{
+			Check:    "probe-port",
+			Expected: Result{Reason: "container [app] has a readiness probe targeting undeclared port [metrics]"},
+			Container: core.Container{
+				Ports:          ports,
+				ReadinessProbe: probe(intstr.FromString("metrics"), 0, 0, 0),
+			},
+		},
+		Test{
+			Check:    "probe-timeout",
+			Expected: Result{Reason: "container [app] has a liveness probe timeout (15s) longer than its period (10s)"},
+			Container: core.Container{
+				LivenessProbe: probe(intstr.FromInt(8080), 15, 0, 5),
+			},
+		},
+		Test{
+			Check:    "probe-timeout",
+			Expected: Result{Passed: true},
+			Container: core.Container{
+				LivenessProbe: probe(intstr.FromInt(8080), 15, 20, 5),
+			},
+		},
+		Test{
+			Check:    "probe-port",
+			Expected: Result{Reason: "container [app] has a startup probe targeting undeclared port [9090]"},
+			Container: core.Container{
+				Ports: ports,
+				StartupProbe: &core.Probe{
+					ProbeHandler: core.ProbeHandler{GRPC: &core.GRPCAction{Port: 9090}},
+				},
+			},
+		},
+		Test{
+			Check:    "probe-delay",
+			Expected: Result{Reason: "container [app] has a liveness probe without an initial delay or startup probe"},
+			Container: core.Container{
+				LivenessProbe: probe(intstr.FromInt(8080), 0, 0, 0),
+			},
+		},
+
+		// A startup probe holds off the liveness probe instead of a delay.
+		Test{
+			Check:    "probe-delay",
+			Expected: Result{Passed: true},
+			Container: core.Container{
+				LivenessProbe: probe(intstr.FromInt(8080), 0, 0, 0),
+				StartupProbe:  probe(intstr.FromInt(8080), 0, 0, 0),
+			},
+		},
+
+		// Containers without probes are left to the liveness and readiness
+		// checks.
+		Test{
+			Check:     "probe-delay",
+			Expected:  Result{Passed: true},
+			Container: core.Container{},
+		},
+	}
+
+	registered := map[string]Check{}
+	for _, check := range GetChecks() {
+		registered[check.Name()] = check
+	}
+	for _, test := range tests {
+		assert.True(t, IsOptionalCheck(test.Check))
+		test.Container.Name = "app"
+		spec := core.PodSpec{Containers: []core.Container{test.Container}}
+		actual := registered[test.Check].Evaluate(&core.Pod{Spec: spec}, meta.ObjectMeta{}, spec, config.NewConfig())
+		assert.Exactly(t, test.Expected, actual, test.Check)
+	}
+}
+
+func TestResourceChecks(t *testing.T) {
+	os.Setenv("SOLSKIN_CHECKS_RESOURCE_BOUNDS_CPU_MIN", "10m")
+	os.Setenv("SOLSKIN_CHECKS_RESOURCE_BOUNDS_MEMORY_MAX", "1Gi")
+	os.Setenv("SOLSKIN_CHECKS_RESOURCE_RATIO_CPU", "2")
+	defer os.Unsetenv("SOLSKIN_CHECKS_RESOURCE_BOUNDS_CPU_MIN")
+	defer os.Unsetenv("SOLSKIN_CHECKS_RESOURCE_BOUNDS_MEMORY_MAX")
+	defer os.Unsetenv("SOLSKIN_CHECKS_RESOURCE_RATIO_CPU")
+	cfg := config.NewConfig()
+	cfg.Load(env.NewSource(env.WithStrippedPrefix("SOLSKIN")))
+
+	SetNamespace(&core.Namespace{ObjectMeta: meta.ObjectMeta{
+		Name:   "guaranteed",
+		Labels: map[string]string{NamespaceQoSLabel: "guaranteed"},
+	}})
+	defer DeleteNamespace("guaranteed")
+
+	list := func(values ...string) core.ResourceList {
+		l := core.ResourceList{}
+		for i := 0; i < len(values); i += 2 {
+			l[core.ResourceName(values[i])] = resource.MustParse(values[i+1])
+		}
+		return l
+	}
+
+	type Test struct {
+		Check     string
+		Expected  Result
+		Namespace string
+		Requests  core.ResourceList
+		Limits    core.ResourceList
+	}
+
+	tests := []Test{
+		Test{
+			Check:    "resource-bounds",
+			Expected: Result{Reason: "container [app] has a cpu request of [1m] below the minimum of [10m]"},
+			Requests: list("cpu", "1m", "memory", "128Mi"),
+		},
+		Test{
+			Check:    "resource-bounds",
+			Expected: Result{Reason: "container [app] has a memory limit of [2Gi] above the maximum of [1Gi]"},
+			Requests: list("cpu", "100m", "memory", "128Mi"),
+			Limits:   list("cpu", "100m", "memory", "2Gi"),
+		},
+		Test{
+			Check:    "resource-bounds",
+			Expected: Result{Passed: true},
+			Requests: list("cpu", "100m", "memory", "128Mi"),
+			Limits:   list("cpu", "100m", "memory", "1Gi"),
+		},
+		Test{
+			Check:    "resource-ratio",
+			Expected: Result{Reason: "container [app] has a cpu limit 5 times its request, above the maximum of 2"},
+			Requests: list("cpu", "100m"),
+			Limits:   list("cpu", "500m"),
+		},
+		Test{
+			Check:    "resource-ratio",
+			Expected: Result{Reason: "container [app] has a memory limit 4 times its request, above the maximum of 2"},
+			Requests: list("cpu", "100m", "memory", "128Mi"),
+			Limits:   list("cpu", "200m", "memory", "512Mi"),
+		},
+		Test{
+			Check:    "resource-ratio",
+			Expected: Result{Passed: true},
+			Requests: list("cpu", "100m", "memory", "128Mi"),
+			Limits:   list("cpu", "200m", "memory", "256Mi"),
+		},
+		Test{
+			Check:    "ephemeral-storage",
+			Expected: Result{Reason: "container [app] is missing ephemeral-storage requests or limits"},
+			Requests: list("ephemeral-storage", "1Gi"),
+		},
+		Test{
+			Check:    "ephemeral-storage",
+			Expected: Result{Passed: true},
+			Requests: list("ephemeral-storage", "1Gi"),
+			Limits:   list("ephemeral-storage", "2Gi"),
+		},
+
+		// Memory limits only have to equal requests in guaranteed namespaces.
+		Test{
+			Check:     "guaranteed-memory",
+			Expected:  Result{Passed: true},
+			Namespace: "default",
+			Requests:  list("memory", "128Mi"),
+			Limits:    list("memory", "256Mi"),
+		},
+		Test{
+			Check:     "guaranteed-memory",
+			Expected:  Result{Reason: "container [app] has a memory limit of [256Mi] different from its request of [128Mi]"},
+			Namespace: "guaranteed",
+			Requests:  list("memory", "128Mi"),
+			Limits:    list("memory", "256Mi"),
+		},
+		Test{
+			Check:     "guaranteed-memory",
+			Expected:  Result{Reason: "container [app] has no memory limit"},
+			Namespace: "guaranteed",
+			Requests:  list("memory", "128Mi"),
+		},
+		Test{
+			Check:     "guaranteed-memory",
+			Expected:  Result{Passed: true},
+			Namespace: "guaranteed",
+			Limits:    list("memory", "256Mi"),
+		},
+	}
+
+	registered := map[string]Check{}
+	for _, check := range GetChecks() {
+		registered[check.Name()] = check
+	}
+	for _, test := range tests {
+		assert.True(t, IsOptionalCheck(test.Check))
+		spec := core.PodSpec{Containers: []core.Container{
+			core.Container{
+				Name:      "app",
+				Resources: core.ResourceRequirements{Requests: test.Requests, Limits: test.Limits},
+			},
+		}}
+		pod := &core.Pod{ObjectMeta: meta.ObjectMeta{Namespace: test.Namespace}, Spec: spec}
+		actual := registered[test.Check].Evaluate(pod, pod.ObjectMeta, spec, cfg)
+		assert.Exactly(t, test.Expected, actual, test.Check)
+	}
+}
+
+func TestIgnoredContainers(t *testing.T) {
+	os.Setenv("SOLSKIN_CHECKS_LIVENESS_IGNORE_CONTAINERS", "istio-proxy, linkerd-.*")
+	os.Setenv("SOLSKIN_CHECKS_INIT_LIMITS_IGNORE_CONTAINERS", "istio-init")
+	defer os.Unsetenv("SOLSKIN_CHECKS_LIVENESS_IGNORE_CONTAINERS")
+	defer os.Unsetenv("SOLSKIN_CHECKS_INIT_LIMITS_IGNORE_CONTAINERS")
+	cfg := config.NewConfig()
+	cfg.Load(env.NewSource(env.WithStrippedPrefix("SOLSKIN")))
+
+	assert.True(t, IsContainerIgnored(cfg, "liveness", "istio-proxy"))
+	assert.True(t, IsContainerIgnored(cfg, "liveness", "linkerd-proxy"))
+	assert.False(t, IsContainerIgnored(cfg, "liveness", "my-istio-proxy"))
+	assert.False(t, IsContainerIgnored(cfg, "readiness", "istio-proxy"))
+
+	probe := &core.Probe{ProbeHandler: core.ProbeHandler{Exec: &core.ExecAction{}}}
+	resources := core.ResourceList{
+		core.ResourceCPU:    resource.MustParse("100m"),
+		core.ResourceMemory: resource.MustParse("128Mi"),
+	}
+	pod := &core.Pod{Spec: core.PodSpec{
+		InitContainers: []core.Container{
+			core.Container{Name: "migrate", Resources: core.ResourceRequirements{Requests: resources, Limits: resources}},
+			core.Container{Name: "istio-init", Resources: core.ResourceRequirements{Requests: resources}},
+		},
+		Containers: []core.Container{
+			core.Container{Name: "app", LivenessProbe: probe, ReadinessProbe: probe},
+			core.Container{Name: "istio-proxy", ReadinessProbe: probe},
+			core.Container{Name: "linkerd-proxy"},
+		},
+	}}
+
+	results := map[string]Result{}
+	for _, evaluation := range EvaluateChecks(pod, cfg, func(string) bool { return true }) {
+		results[evaluation.Check.Name()] = evaluation.Result
+	}
+	assert.True(t, results["liveness"].Passed)
+	assert.Exactly(t, "container [linkerd-proxy] has no readiness probe", results["readiness"].Reason)
+	assert.True(t, results["init-requests"].Passed)
+	assert.True(t, results["init-limits"].Passed)
+
+	// Init containers are checked unless ignored.
+	results = map[string]Result{}
+	for _, evaluation := range EvaluateChecks(pod, config.NewConfig(), func(string) bool { return true }) {
+		results[evaluation.Check.Name()] = evaluation.Result
+	}
+	assert.True(t, results["init-requests"].Passed)
+	assert.Exactly(t, "init container [istio-init] is missing cpu or memory limits", results["init-limits"].Reason)
+}
+
+func TestSecurityChecks(t *testing.T) {
+	os.Setenv("SOLSKIN_CHECKS_HOST_PATH_ALLOWED", "/var/log, /etc/ssl/certs")
+	defer os.Unsetenv("SOLSKIN_CHECKS_HOST_PATH_ALLOWED")
+	cfg := config.NewConfig()
+	cfg.Load(env.NewSource(env.WithStrippedPrefix("SOLSKIN")))
+
+	yes, no, root, user := true, false, int64(0), int64(1000)
+	hardened := &core.SecurityContext{
+		RunAsNonRoot:             &yes,
+		Privileged:               &no,
+		AllowPrivilegeEscalation: &no,
+		ReadOnlyRootFilesystem:   &yes,
+		Capabilities:             &core.Capabilities{Drop: []core.Capability{"ALL"}},
+	}
+	hostPath := func(name string, path string) core.Volume {
+		return core.Volume{Name: name, VolumeSource: core.VolumeSource{HostPath: &core.HostPathVolumeSource{Path: path}}}
+	}
+
+	type Test struct {
+		Check    string
+		Expected Result
+		Spec     core.PodSpec
+	}
+
+	tests := []Test{
+		Test{
+			Check:    "run-as-non-root",
+			Expected: Result{Reason: "container [app] is not required to run as a non-root user"},
+			Spec:     core.PodSpec{Containers: []core.Container{core.Container{Name: "app"}}},
+		},
+		Test{
+			Check:    "run-as-non-root",
+			Expected: Result{Passed: true},
+			Spec: core.PodSpec{
+				SecurityContext: &core.PodSecurityContext{RunAsNonRoot: &yes, RunAsUser: &user},
+				Containers:      []core.Container{core.Container{Name: "app"}},
+			},
+		},
+		Test{
+			Check:    "run-as-non-root",
+			Expected: Result{Reason: "container [app] runs as root"},
+			Spec: core.PodSpec{
+				SecurityContext: &core.PodSecurityContext{RunAsNonRoot: &yes},
+				Containers: []core.Container{
+					core.Container{Name: "app", SecurityContext: &core.SecurityContext{RunAsUser: &root}},
+				},
+			},
+		},
+		Test{
+			Check:    "privileged",
+			Expected: Result{Reason: "init container [setup] is privileged"},
+			Spec: core.PodSpec{
+				InitContainers: []core.Container{
+					core.Container{Name: "setup", SecurityContext: &core.SecurityContext{Privileged: &yes}},
+				},
+				Containers: []core.Container{core.Container{Name: "app"}},
+			},
+		},
+		Test{
+			Check:    "privilege-escalation",
+			Expected: Result{Reason: "container [app] does not disallow privilege escalation"},
+			Spec:     core.PodSpec{Containers: []core.Container{core.Container{Name: "app"}}},
+		},
+		Test{
+			Check:    "read-only-root-filesystem",
+			Expected: Result{Reason: "container [app] has a writable root filesystem"},
+			Spec:     core.PodSpec{Containers: []core.Container{core.Container{Name: "app"}}},
+		},
+		Test{
+			Check:    "capabilities",
+			Expected: Result{Reason: "container [app] does not drop all capabilities"},
+			Spec: core.PodSpec{Containers: []core.Container{
+				core.Container{Name: "app", SecurityContext: &core.SecurityContext{
+					Capabilities: &core.Capabilities{Drop: []core.Capability{"NET_RAW"}},
+				}},
+			}},
+		},
+		Test{
+			Check:    "host-namespaces",
+			Expected: Result{Reason: "pod shares the host's network, ipc namespace(s)"},
+			Spec:     core.PodSpec{HostNetwork: true, HostIPC: true},
+		},
+		Test{
+			Check:    "host-path",
+			Expected: Result{Passed: true},
+			Spec:     core.PodSpec{Volumes: []core.Volume{hostPath("logs", "/var/log/app"), hostPath("certs", "/etc/ssl/certs")}},
+		},
+		Test{
+			Check:    "host-path",
+			Expected: Result{Reason: "volume [docker] mounts host path [/var/run/docker.sock]"},
+			Spec:     core.PodSpec{Volumes: []core.Volume{hostPath("logs", "/var/log"), hostPath("docker", "/var/run/docker.sock")}},
+		},
+		Test{
+			Check:    "host-path",
+			Expected: Result{Reason: "volume [logs] mounts host path [/var/logs]"},
+			Spec:     core.PodSpec{Volumes: []core.Volume{hostPath("logs", "/var/logs")}},
+		},
+	}
+
+	// A hardened container passes every container check.
+	for _, check := range []string{"run-as-non-root", "privileged", "privilege-escalation", "read-only-root-filesystem", "capabilities"} {
+		tests = append(tests, Test{
+			Check:    check,
+			Expected: Result{Passed: true},
+			Spec:     core.PodSpec{Containers: []core.Container{core.Container{Name: "app", SecurityContext: hardened}}},
+		})
+	}
+
+	registered := map[string]Check{}
+	for _, check := range GetChecks() {
+		registered[check.Name()] = check
+	}
+	for _, test := range tests {
+		assert.True(t, IsOptionalCheck(test.Check))
+		pod := &core.Pod{Spec: test.Spec}
+		actual := registered[test.Check].Evaluate(pod, pod.ObjectMeta, test.Spec, cfg)
+		assert.Exactly(t, test.Expected, actual, test.Check)
+	}
+}
@@ -0,0 +1,37 @@
+package common
+
+import (
+	"encoding/json"
+	apps "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+)
+
+// DecodeObject decodes the JSON encoding of a kubernetes resource of the given
+// kind into its typed object, returning nil for kinds of resources the checks
+// don't apply to. Workloads of older API versions are decoded into their
+// apps/v1 equivalent.
+func DecodeObject(kind string, data []byte) (interface{}, error) {
+	var obj interface{}
+	switch kind {
+	case "Pod":
+		obj = &core.Pod{}
+	case "Deployment":
+		obj = &apps.Deployment{}
+	case "DaemonSet":
+		obj = &apps.DaemonSet{}
+	case "StatefulSet":
+		obj = &apps.StatefulSet{}
+	case "ReplicaSet":
+		obj = &apps.ReplicaSet{}
+	case "Job":
+		obj = &batch.Job{}
+	default:
+		return nil, nil
+	}
+
+	if err := json.Unmarshal(data, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
@@ -0,0 +1,136 @@
+package common
+
+import (
+	config "github.com/micro/go-config"
+	apps "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	// ExemptAnnotation exempts a resource from all checks when set to "true".
+	ExemptAnnotation = "solskin.io/exempt"
+
+	// SkipChecksAnnotation is a comma separated list of checks the resource is
+	// exempted from.
+	SkipChecksAnnotation = "solskin.io/skip-checks"
+
+	// ExemptReasonAnnotation documents why the resource is exempted.
+	ExemptReasonAnnotation = "solskin.io/exempt-reason"
+
+	// ExemptUntilAnnotation is the date (or RFC3339 timestamp) the exemption
+	// expires at.
+	ExemptUntilAnnotation = "solskin.io/exempt-until"
+)
+
+// GetPodTemplateMeta will extract the metadata of the pod template from any
+// type of kubernetes resource, for pods this is the pod's own metadata.
+func GetPodTemplateMeta(obj interface{}) meta.ObjectMeta {
+	switch o := obj.(type) {
+	case *apps.Deployment:
+		return o.Spec.Template.ObjectMeta
+	case *apps.DaemonSet:
+		return o.Spec.Template.ObjectMeta
+	case *apps.StatefulSet:
+		return o.Spec.Template.ObjectMeta
+	case *apps.ReplicaSet:
+		return o.Spec.Template.ObjectMeta
+	case *batch.Job:
+		return o.Spec.Template.ObjectMeta
+	}
+
+	m, _ := GetObjectMeta(obj)
+	return m
+}
+
+// IsExempt determines whether or not the resource is exempted from all checks
+// through its annotations.
+func IsExempt(obj interface{}, cfg config.Config) bool {
+	annotations := getExemptionAnnotations(obj)
+	if annotations[ExemptAnnotation] != "true" {
+		return false
+	}
+	return isValidExemption(obj, annotations, cfg)
+}
+
+// GetSkippedChecks returns the checks the resource is exempted from through its
+// annotations.
+func GetSkippedChecks(obj interface{}, cfg config.Config) []string {
+	annotations := getExemptionAnnotations(obj)
+	value := annotations[SkipChecksAnnotation]
+	if value == "" || !isValidExemption(obj, annotations, cfg) {
+		return []string{}
+	}
+
+	checks := []string{}
+	for _, check := range strings.Split(value, ",") {
+		if check = strings.TrimSpace(check); check != "" {
+			checks = append(checks, check)
+		}
+	}
+	return checks
+}
+
+// IsCheckSkipped is a helper function to determine if the check is in the
+// list of skipped checks.
+func IsCheckSkipped(check string, skipped []string) bool {
+	for _, s := range skipped {
+		if s == check {
+			return true
+		}
+	}
+	return false
+}
+
+// Helper function to gather the exemption annotations from both the resource
+// and its pod template, the resource's own annotations taking precedence.
+func getExemptionAnnotations(obj interface{}) map[string]string {
+	m, _ := GetObjectMeta(obj)
+	annotations := map[string]string{}
+	for _, source := range []meta.ObjectMeta{GetPodTemplateMeta(obj), m} {
+		for _, key := range []string{
+			ExemptAnnotation,
+			SkipChecksAnnotation,
+			ExemptReasonAnnotation,
+			ExemptUntilAnnotation,
+		} {
+			if value, ok := source.GetAnnotations()[key]; ok {
+				annotations[key] = value
+			}
+		}
+	}
+	return annotations
+}
+
+// Helper function to determine if an exemption has a reason, when required,
+// and has not expired.
+func isValidExemption(obj interface{}, annotations map[string]string, cfg config.Config) bool {
+	required := cfg.Get("eligibility", "exempt", "reason", "required").Bool(false)
+	if required && strings.TrimSpace(annotations[ExemptReasonAnnotation]) == "" {
+		log.Printf("[%s] exemption ignored, no reason given", GetFullLabel(obj))
+		return false
+	}
+
+	until, ok := annotations[ExemptUntilAnnotation]
+	if !ok {
+		return true
+	}
+
+	expiry, err := time.Parse(time.RFC3339, until)
+	if err != nil {
+		expiry, err = time.Parse("2006-01-02", until)
+	}
+	if err != nil {
+		log.Printf("[%s] exemption ignored, could not parse expiry [%s]", GetFullLabel(obj), until)
+		return false
+	}
+
+	if time.Now().After(expiry) {
+		log.Printf("[%s] exemption ignored, expired at [%s]", GetFullLabel(obj), until)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,143 @@
+package common
+
+import (
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+	"sort"
+	"sync"
+)
+
+// Kinds of prometheus-operator monitors.
+const (
+	KindServiceMonitor = "servicemonitor"
+	KindPodMonitor     = "podmonitor"
+)
+
+// Monitor is a prometheus-operator ServiceMonitor or PodMonitor, reduced to
+// what is needed to determine which pods it scrapes.
+type Monitor struct {
+	Kind      string
+	Name      string
+	Namespace string
+
+	// Selector for the labels of the services or pods that are scraped.
+	Selector labels.Selector
+
+	// Namespaces of the services or pods that are scraped, all namespaces when
+	// AnyNamespace is set.
+	AnyNamespace bool
+	Namespaces   []string
+}
+
+// Store of the monitors and services in the cluster, kept up to date by the
+// monitor informers.
+var monitors = struct {
+	sync.RWMutex
+	m        map[string]Monitor
+	services map[string]*core.Service
+}{
+	m:        map[string]Monitor{},
+	services: map[string]*core.Service{},
+}
+
+// ServiceEventHandlers returns the event handlers that keep the services of
+// the monitor store up to date.
+func ServiceEventHandlers() cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { SetService(obj.(*core.Service)) },
+		UpdateFunc: func(_, obj interface{}) { SetService(obj.(*core.Service)) },
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if svc, ok := obj.(*core.Service); ok {
+				DeleteService(svc)
+			}
+		},
+	}
+}
+
+// SetMonitor adds or updates the monitor in the monitor store.
+func SetMonitor(m Monitor) {
+	monitors.Lock()
+	defer monitors.Unlock()
+	monitors.m[m.Kind+":"+m.Namespace+"/"+m.Name] = m
+}
+
+// DeleteMonitor removes the monitor from the monitor store.
+func DeleteMonitor(kind string, namespace string, name string) {
+	monitors.Lock()
+	defer monitors.Unlock()
+	delete(monitors.m, kind+":"+namespace+"/"+name)
+}
+
+// SetService adds or updates the service in the monitor store.
+func SetService(svc *core.Service) {
+	monitors.Lock()
+	defer monitors.Unlock()
+	monitors.services[svc.GetNamespace()+"/"+svc.GetName()] = svc
+}
+
+// DeleteService removes the service from the monitor store.
+func DeleteService(svc *core.Service) {
+	monitors.Lock()
+	defer monitors.Unlock()
+	delete(monitors.services, svc.GetNamespace()+"/"+svc.GetName())
+}
+
+// FindMonitor returns the name of a monitor scraping pods with the given
+// labels in the given namespace, either directly through a PodMonitor or
+// through a ServiceMonitor selecting a service that targets the pods.
+func FindMonitor(namespace string, podLabels map[string]string) (string, bool) {
+	monitors.RLock()
+	defer monitors.RUnlock()
+
+	keys := []string{}
+	for key := range monitors.m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	set := labels.Set(podLabels)
+	for _, key := range keys {
+		m := monitors.m[key]
+		if m.Selector == nil || !m.watches(namespace) {
+			continue
+		}
+
+		switch m.Kind {
+		case KindPodMonitor:
+			if m.Selector.Matches(set) {
+				return key, true
+			}
+		case KindServiceMonitor:
+			for _, svc := range monitors.services {
+				if svc.GetNamespace() != namespace || !m.Selector.Matches(labels.Set(svc.GetLabels())) {
+					continue
+				}
+				if len(svc.Spec.Selector) > 0 && labels.SelectorFromSet(svc.Spec.Selector).Matches(set) {
+					return key, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// Helper function to determine whether or not the monitor scrapes targets in
+// the given namespace.
+func (m Monitor) watches(namespace string) bool {
+	if m.AnyNamespace {
+		return true
+	}
+	if len(m.Namespaces) == 0 {
+		return namespace == m.Namespace
+	}
+	for _, ns := range m.Namespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package common
+
+import (
+	core "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"sync"
+)
+
+const (
+	// NamespaceEnabledLabel opts a namespace in ("true") or out ("false") of
+	// monitoring and suppression, overriding the namespace exclusion pattern.
+	NamespaceEnabledLabel = "solskin.io/enabled"
+
+	// NamespaceActionLabel overrides the action the suppressor takes for
+	// resources in the namespace.
+	NamespaceActionLabel = "solskin.io/action"
+
+	// NamespaceAutofixLabel opts a namespace in ("true") to having missing
+	// requests and limits filled in by the mutating webhook. Unlike the other
+	// settings it only works as a label, since the webhook registration selects
+	// namespaces by it.
+	NamespaceAutofixLabel = "solskin.io/autofix"
+
+	// NamespaceQoSLabel declares the quality of service class expected of the
+	// pods in the namespace, where "guaranteed" requires memory limits to
+	// equal requests.
+	NamespaceQoSLabel = "solskin.io/qos"
+)
+
+// Store of the namespaces in the cluster, kept up to date by the namespace
+// informer.
+var namespaces = struct {
+	sync.RWMutex
+	m map[string]*core.Namespace
+}{m: map[string]*core.Namespace{}}
+
+// NamespaceEventHandlers returns the event handlers that keep the namespace
+// store up to date.
+func NamespaceEventHandlers() cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { SetNamespace(obj.(*core.Namespace)) },
+		UpdateFunc: func(_, obj interface{}) { SetNamespace(obj.(*core.Namespace)) },
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if ns, ok := obj.(*core.Namespace); ok {
+				DeleteNamespace(ns.GetName())
+			}
+		},
+	}
+}
+
+// SetNamespace adds or updates the namespace in the namespace store.
+func SetNamespace(ns *core.Namespace) {
+	namespaces.Lock()
+	defer namespaces.Unlock()
+	namespaces.m[ns.GetName()] = ns
+}
+
+// DeleteNamespace removes the namespace from the namespace store.
+func DeleteNamespace(name string) {
+	namespaces.Lock()
+	defer namespaces.Unlock()
+	delete(namespaces.m, name)
+}
+
+// GetNamespaceSetting returns the value of the given key from the labels, or
+// failing that the annotations, of the named namespace.
+func GetNamespaceSetting(name string, key string) (string, bool) {
+	namespaces.RLock()
+	defer namespaces.RUnlock()
+
+	ns, ok := namespaces.m[name]
+	if !ok {
+		return "", false
+	}
+
+	if value, ok := ns.GetLabels()[key]; ok {
+		return value, true
+	}
+	value, ok := ns.GetAnnotations()[key]
+	return value, ok
+}
@@ -0,0 +1,137 @@
+package common
+
+import (
+	"fmt"
+	config "github.com/micro/go-config"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"reflect"
+)
+
+// Defaults kubernetes uses for the timing of probes that don't set it.
+const (
+	defaultProbeTimeout = 1
+	defaultProbePeriod  = 10
+)
+
+// Checks of the quality of probes, containers without probes pass since the
+// liveness and readiness checks already cover them.
+func init() {
+	RegisterOptionalCheck(CheckFunc{
+		CheckName:        "probe-distinct",
+		CheckDescription: "proof of distinct liveness and readiness probes",
+		Func: func(_ interface{}, _ meta.ObjectMeta, spec core.PodSpec, _ config.Config) Result {
+			return firstProblem(spec, func(c core.Container) string {
+				if c.LivenessProbe != nil && c.ReadinessProbe != nil && reflect.DeepEqual(c.LivenessProbe, c.ReadinessProbe) {
+					return "has identical liveness and readiness probes"
+				}
+				return ""
+			})
+		},
+	})
+	RegisterOptionalCheck(CheckFunc{
+		CheckName:        "probe-port",
+		CheckDescription: "proof of probes targeting declared ports",
+		Func: func(_ interface{}, _ meta.ObjectMeta, spec core.PodSpec, _ config.Config) Result {
+			return firstProblem(spec, func(c core.Container) string {
+				for _, p := range probes(c) {
+					if port, ok := probePort(p.probe); ok && !hasContainerPort(c, port) {
+						return fmt.Sprintf("has a %s probe targeting undeclared port [%s]", p.kind, port.String())
+					}
+				}
+				return ""
+			})
+		},
+	})
+	RegisterOptionalCheck(CheckFunc{
+		CheckName:        "probe-timeout",
+		CheckDescription: "proof of probe timeouts within their period",
+		Func: func(_ interface{}, _ meta.ObjectMeta, spec core.PodSpec, _ config.Config) Result {
+			return firstProblem(spec, func(c core.Container) string {
+				for _, p := range probes(c) {
+					timeout, period := probeTiming(p.probe)
+					if timeout > period {
+						return fmt.Sprintf("has a %s probe timeout (%ds) longer than its period (%ds)", p.kind, timeout, period)
+					}
+				}
+				return ""
+			})
+		},
+	})
+	RegisterOptionalCheck(CheckFunc{
+		CheckName:        "probe-delay",
+		CheckDescription: "proof of an initial delay or startup probe before liveness probes",
+		Func: func(_ interface{}, _ meta.ObjectMeta, spec core.PodSpec, _ config.Config) Result {
+			return firstProblem(spec, func(c core.Container) string {
+				// Liveness probes only start once the startup probe succeeds.
+				if c.LivenessProbe != nil && c.StartupProbe == nil && c.LivenessProbe.InitialDelaySeconds <= 0 {
+					return "has a liveness probe without an initial delay or startup probe"
+				}
+				return ""
+			})
+		},
+	})
+}
+
+// Probe of a container, along with its kind.
+type containerProbe struct {
+	kind  string
+	probe *core.Probe
+}
+
+// Helper function to retrieve the probes a container defines.
+func probes(c core.Container) []containerProbe {
+	found := []containerProbe{}
+	if c.LivenessProbe != nil {
+		found = append(found, containerProbe{"liveness", c.LivenessProbe})
+	}
+	if c.ReadinessProbe != nil {
+		found = append(found, containerProbe{"readiness", c.ReadinessProbe})
+	}
+	if c.StartupProbe != nil {
+		found = append(found, containerProbe{"startup", c.StartupProbe})
+	}
+	return found
+}
+
+// Helper function to retrieve the port a network probe targets.
+func probePort(probe *core.Probe) (intstr.IntOrString, bool) {
+	if probe.HTTPGet != nil {
+		return probe.HTTPGet.Port, true
+	}
+	if probe.TCPSocket != nil {
+		return probe.TCPSocket.Port, true
+	}
+	if probe.GRPC != nil {
+		return intstr.FromInt(int(probe.GRPC.Port)), true
+	}
+	return intstr.IntOrString{}, false
+}
+
+// Helper function to retrieve the timeout and period of a probe in seconds,
+// falling back to the kubernetes defaults.
+func probeTiming(probe *core.Probe) (int32, int32) {
+	timeout, period := probe.TimeoutSeconds, probe.PeriodSeconds
+	if timeout <= 0 {
+		timeout = defaultProbeTimeout
+	}
+	if period <= 0 {
+		period = defaultProbePeriod
+	}
+	return timeout, period
+}
+
+// Helper function to determine if the port, given by number or name, is
+// declared by the container.
+func hasContainerPort(c core.Container, port intstr.IntOrString) bool {
+	for _, p := range c.Ports {
+		if port.Type == intstr.String && p.Name == port.StrVal {
+			return true
+		}
+		if port.Type == intstr.Int && p.ContainerPort == port.IntVal {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package common
+
+import (
+	"fmt"
+	config "github.com/micro/go-config"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"log"
+)
+
+// Resources the bounds and ratio checks apply to.
+var boundedResources = []core.ResourceName{
+	core.ResourceCPU,
+	core.ResourceMemory,
+}
+
+// Default maximum ratio of limits to requests, by resource.
+var defaultRatios = map[core.ResourceName]float64{
+	core.ResourceCPU:    4,
+	core.ResourceMemory: 2,
+}
+
+// Checks of the values of requests and limits, beyond their presence.
+func init() {
+	RegisterOptionalCheck(CheckFunc{
+		CheckName:        "resource-bounds",
+		CheckDescription: "proof of requests and limits within bounds",
+		Func: func(_ interface{}, _ meta.ObjectMeta, spec core.PodSpec, cfg config.Config) Result {
+			return firstProblem(spec, func(c core.Container) string {
+				for _, name := range boundedResources {
+					min := getQuantitySetting(cfg, "resource-bounds", string(name), "min")
+					max := getQuantitySetting(cfg, "resource-bounds", string(name), "max")
+					for i, list := range []core.ResourceList{c.Resources.Requests, c.Resources.Limits} {
+						kind := []string{"request", "limit"}[i]
+						value, ok := list[name]
+						if !ok {
+							continue
+						}
+						if min != nil && value.Cmp(*min) < 0 {
+							return fmt.Sprintf("has a %s %s of [%s] below the minimum of [%s]", name, kind, value.String(), min.String())
+						}
+						if max != nil && value.Cmp(*max) > 0 {
+							return fmt.Sprintf("has a %s %s of [%s] above the maximum of [%s]", name, kind, value.String(), max.String())
+						}
+					}
+				}
+				return ""
+			})
+		},
+	})
+	RegisterOptionalCheck(CheckFunc{
+		CheckName:        "resource-ratio",
+		CheckDescription: "proof of limits within a ratio of requests",
+		Func: func(_ interface{}, _ meta.ObjectMeta, spec core.PodSpec, cfg config.Config) Result {
+			return firstProblem(spec, func(c core.Container) string {
+				for _, name := range boundedResources {
+					request, ok := c.Resources.Requests[name]
+					limit, found := c.Resources.Limits[name]
+					if !ok || !found || request.MilliValue() <= 0 {
+						continue
+					}
+
+					max := GetCheckSetting(cfg, "resource-ratio", string(name)).Float64(defaultRatios[name])
+					ratio := float64(limit.MilliValue()) / float64(request.MilliValue())
+					if ratio > max {
+						return fmt.Sprintf("has a %s limit %.4g times its request, above the maximum of %.4g", name, ratio, max)
+					}
+				}
+				return ""
+			})
+		},
+	})
+	RegisterOptionalCheck(CheckFunc{
+		CheckName:        "ephemeral-storage",
+		CheckDescription: "proof of ephemeral storage requests and limits",
+		Func: func(_ interface{}, _ meta.ObjectMeta, spec core.PodSpec, _ config.Config) Result {
+			return firstProblem(spec, func(c core.Container) string {
+				_, requested := c.Resources.Requests[core.ResourceEphemeralStorage]
+				_, limited := c.Resources.Limits[core.ResourceEphemeralStorage]
+				if !requested || !limited {
+					return "is missing ephemeral-storage requests or limits"
+				}
+				return ""
+			})
+		},
+	})
+	RegisterOptionalCheck(CheckFunc{
+		CheckName:        "guaranteed-memory",
+		CheckDescription: "proof of memory limits equal to requests in guaranteed namespaces",
+		Func: func(obj interface{}, _ meta.ObjectMeta, spec core.PodSpec, _ config.Config) Result {
+			m, _ := GetObjectMeta(obj)
+			if qos, _ := GetNamespaceSetting(m.GetNamespace(), NamespaceQoSLabel); qos != "guaranteed" {
+				return Result{Passed: true}
+			}
+
+			return firstProblem(spec, func(c core.Container) string {
+				limit, ok := c.Resources.Limits[core.ResourceMemory]
+				if !ok {
+					return "has no memory limit"
+				}
+
+				// Requests default to the limit when left out.
+				if request, ok := c.Resources.Requests[core.ResourceMemory]; ok && request.Cmp(limit) != 0 {
+					return fmt.Sprintf("has a memory limit of [%s] different from its request of [%s]", limit.String(), request.String())
+				}
+				return ""
+			})
+		},
+	})
+}
+
+// Helper function to read a quantity from the configuration of a check,
+// returning nil when it isn't set or can't be parsed.
+func getQuantitySetting(cfg config.Config, check string, key ...string) *resource.Quantity {
+	value := GetCheckSetting(cfg, check, key...).String("")
+	if value == "" {
+		return nil
+	}
+
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil {
+		log.Printf("could not parse %s quantity, value given: [%s]", check, value)
+		return nil
+	}
+	return &quantity
+}
@@ -0,0 +1,159 @@
+package common
+
+import (
+	"fmt"
+	config "github.com/micro/go-config"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"path"
+	"strings"
+)
+
+// Checks of the security posture of pods, evaluated against both containers
+// and init containers.
+func init() {
+	RegisterOptionalCheck(CheckFunc{
+		CheckName:        "run-as-non-root",
+		CheckDescription: "proof of running as a non-root user",
+		Func: func(_ interface{}, _ meta.ObjectMeta, spec core.PodSpec, _ config.Config) Result {
+			return firstContainerProblem(spec, func(c core.Container) string {
+				// Container settings take precedence over the pod's.
+				nonRoot, user := false, (*int64)(nil)
+				if sc := spec.SecurityContext; sc != nil {
+					nonRoot = sc.RunAsNonRoot != nil && *sc.RunAsNonRoot
+					user = sc.RunAsUser
+				}
+				if sc := c.SecurityContext; sc != nil {
+					if sc.RunAsNonRoot != nil {
+						nonRoot = *sc.RunAsNonRoot
+					}
+					if sc.RunAsUser != nil {
+						user = sc.RunAsUser
+					}
+				}
+
+				if user != nil && *user == 0 {
+					return "runs as root"
+				}
+				if !nonRoot {
+					return "is not required to run as a non-root user"
+				}
+				return ""
+			})
+		},
+	})
+	RegisterOptionalCheck(CheckFunc{
+		CheckName:        "privileged",
+		CheckDescription: "proof of unprivileged containers",
+		Func: func(_ interface{}, _ meta.ObjectMeta, spec core.PodSpec, _ config.Config) Result {
+			return firstContainerProblem(spec, func(c core.Container) string {
+				if sc := c.SecurityContext; sc != nil && sc.Privileged != nil && *sc.Privileged {
+					return "is privileged"
+				}
+				return ""
+			})
+		},
+	})
+	RegisterOptionalCheck(CheckFunc{
+		CheckName:        "privilege-escalation",
+		CheckDescription: "proof of disallowed privilege escalation",
+		Func: func(_ interface{}, _ meta.ObjectMeta, spec core.PodSpec, _ config.Config) Result {
+			return firstContainerProblem(spec, func(c core.Container) string {
+				if sc := c.SecurityContext; sc == nil || sc.AllowPrivilegeEscalation == nil || *sc.AllowPrivilegeEscalation {
+					return "does not disallow privilege escalation"
+				}
+				return ""
+			})
+		},
+	})
+	RegisterOptionalCheck(CheckFunc{
+		CheckName:        "read-only-root-filesystem",
+		CheckDescription: "proof of read-only root filesystems",
+		Func: func(_ interface{}, _ meta.ObjectMeta, spec core.PodSpec, _ config.Config) Result {
+			return firstContainerProblem(spec, func(c core.Container) string {
+				if sc := c.SecurityContext; sc == nil || sc.ReadOnlyRootFilesystem == nil || !*sc.ReadOnlyRootFilesystem {
+					return "has a writable root filesystem"
+				}
+				return ""
+			})
+		},
+	})
+	RegisterOptionalCheck(CheckFunc{
+		CheckName:        "capabilities",
+		CheckDescription: "proof of dropped capabilities",
+		Func: func(_ interface{}, _ meta.ObjectMeta, spec core.PodSpec, _ config.Config) Result {
+			return firstContainerProblem(spec, func(c core.Container) string {
+				if sc := c.SecurityContext; sc != nil && sc.Capabilities != nil {
+					for _, capability := range sc.Capabilities.Drop {
+						if strings.ToUpper(string(capability)) == "ALL" {
+							return ""
+						}
+					}
+				}
+				return "does not drop all capabilities"
+			})
+		},
+	})
+	RegisterOptionalCheck(CheckFunc{
+		CheckName:        "host-namespaces",
+		CheckDescription: "proof of unshared host namespaces",
+		Func: func(_ interface{}, _ meta.ObjectMeta, spec core.PodSpec, _ config.Config) Result {
+			shared := []string{}
+			if spec.HostNetwork {
+				shared = append(shared, "network")
+			}
+			if spec.HostPID {
+				shared = append(shared, "pid")
+			}
+			if spec.HostIPC {
+				shared = append(shared, "ipc")
+			}
+			if len(shared) > 0 {
+				return Result{Reason: fmt.Sprintf("pod shares the host's %s namespace(s)", strings.Join(shared, ", "))}
+			}
+			return Result{Passed: true}
+		},
+	})
+	RegisterOptionalCheck(CheckFunc{
+		CheckName:        "host-path",
+		CheckDescription: "proof of no host path volumes",
+		Func: func(_ interface{}, _ meta.ObjectMeta, spec core.PodSpec, cfg config.Config) Result {
+			allowed := GetCheckSetting(cfg, "host-path", "allowed").String("")
+			for _, volume := range spec.Volumes {
+				if volume.HostPath != nil && !isAllowedPath(volume.HostPath.Path, allowed) {
+					return Result{Reason: fmt.Sprintf("volume [%s] mounts host path [%s]", volume.Name, volume.HostPath.Path)}
+				}
+			}
+			return Result{Passed: true}
+		},
+	})
+}
+
+// Helper function to build the result of a check evaluated per container and
+// init container, naming the first one with a problem.
+func firstContainerProblem(spec core.PodSpec, problem func(core.Container) string) Result {
+	for _, container := range spec.InitContainers {
+		if reason := problem(container); reason != "" {
+			return Result{Reason: fmt.Sprintf("init container [%s] %s", container.Name, reason)}
+		}
+	}
+	return firstProblem(spec, problem)
+}
+
+// Helper function to determine if the host path is one of the comma separated
+// allowed paths, or lies beneath one of them.
+func isAllowedPath(p string, allowed string) bool {
+	p = path.Clean(p)
+	for _, a := range strings.Split(allowed, ",") {
+		a = strings.TrimSpace(a)
+		if a == "" {
+			continue
+		}
+
+		a = path.Clean(a)
+		if p == a || strings.HasPrefix(p, strings.TrimSuffix(a, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
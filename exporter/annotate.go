@@ -0,0 +1,88 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ccpgames/kube-solskin-controller/common"
+	"github.com/ccpgames/kube-solskin-controller/leader"
+	"log"
+	"reflect"
+	"time"
+)
+
+// ComplianceAnnotation is the annotation used to record the results of the
+// checks on the resource itself.
+const ComplianceAnnotation = "solskin.io/compliance"
+
+// Compliance is the value of the compliance annotation.
+type Compliance struct {
+	Checks      []CheckResult `json:"checks"`
+	EvaluatedAt string        `json:"evaluatedAt"`
+}
+
+// CheckResult is the result of a single check, as recorded in the compliance
+// annotation.
+type CheckResult struct {
+	Check  string `json:"check"`
+	Passed bool   `json:"passed"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Helper function to determine whether or not the results of the checks
+// should be written back onto the resources.
+func (s Service) annotating() bool {
+	return s.Configuration.Get(s.GetSlug(), "annotate").Bool(false) && leader.IsLeader()
+}
+
+// Helper function to record the results of the checks in the compliance
+// annotation of the resource. The resource is only patched when the results
+// differ from the recorded ones, so that resyncs and the update caused by the
+// patch itself don't lead to more writes.
+func (s Service) annotate(obj interface{}, results []CheckResult) error {
+	if !s.annotating() {
+		return nil
+	}
+
+	m, _ := common.GetObjectMeta(obj)
+	if recorded, ok := m.GetAnnotations()[ComplianceAnnotation]; ok {
+		previous := Compliance{}
+		if err := json.Unmarshal([]byte(recorded), &previous); err == nil && reflect.DeepEqual(previous.Checks, results) {
+			return nil
+		}
+	}
+
+	value, err := json.Marshal(Compliance{
+		Checks:      results,
+		EvaluatedAt: time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[%s] recording compliance annotation", common.GetFullLabel(obj))
+	err = common.PatchAnnotations(s.Client, obj, map[string]string{ComplianceAnnotation: string(value)})
+	if err != nil {
+		return fmt.Errorf("could not record compliance annotation: %s", err)
+	}
+	return nil
+}
+
+// Helper function to remove the compliance annotation from a resource that is
+// no longer monitored, so that it doesn't report stale results.
+func (s Service) clearAnnotation(obj interface{}) error {
+	if !s.annotating() {
+		return nil
+	}
+
+	m, _ := common.GetObjectMeta(obj)
+	if _, ok := m.GetAnnotations()[ComplianceAnnotation]; !ok {
+		return nil
+	}
+
+	log.Printf("[%s] removing compliance annotation", common.GetFullLabel(obj))
+	err := common.PatchAnnotations(s.Client, obj, map[string]string{ComplianceAnnotation: ""})
+	if err != nil {
+		return fmt.Errorf("could not remove compliance annotation: %s", err)
+	}
+	return nil
+}
@@ -4,23 +4,21 @@ import (
 	"fmt"
 	"github.com/micro/go-config"
 	"log"
+	"strings"
 
 	"github.com/prometheus/client_golang/prometheus"
 
+	core "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/cache"
 
 	"github.com/ccpgames/kube-solskin-controller/common"
+	"github.com/ccpgames/kube-solskin-controller/leader"
+	"github.com/ccpgames/kube-solskin-controller/notifier"
+	"github.com/ccpgames/kube-solskin-controller/policy"
+	"github.com/ccpgames/kube-solskin-controller/queue"
 )
 
-var categories = []string{
-	"observability",
-	"liveness",
-	"readiness",
-	"requests",
-	"limits",
-}
-var promMetrics = make(map[string]*prometheus.GaugeVec, len(categories))
+var promMetrics = make(map[string]*prometheus.GaugeVec)
 
 // Service is the base service for the exporter service.
 type Service struct {
@@ -34,12 +32,11 @@ func (s Service) GetSlug() string {
 }
 
 // GenerateEventHandlers returns all event handlers used by this service.
-func (s Service) GenerateEventHandlers() []cache.ResourceEventHandlerFuncs {
-	return []cache.ResourceEventHandlerFuncs{
-		cache.ResourceEventHandlerFuncs{
-			AddFunc:    func(obj interface{}) { s.onObjectChange(obj) },
-			UpdateFunc: func(_, obj interface{}) { s.onObjectChange(obj) },
-			DeleteFunc: func(obj interface{}) { s.onObjectDelete(obj) },
+func (s Service) GenerateEventHandlers() []queue.Handlers {
+	return []queue.Handlers{
+		queue.Handlers{
+			OnChange: s.onObjectChange,
+			OnDelete: s.onObjectDelete,
 		},
 	}
 }
@@ -47,13 +44,14 @@ func (s Service) GenerateEventHandlers() []cache.ResourceEventHandlerFuncs {
 // Init will register the prometheus metrics the exporter is responsible for
 // updating.
 func (s Service) Init() {
-	// Initialize our metrics.
-	for _, category := range categories {
-		promMetrics[category] = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Name: fmt.Sprintf("solskin_%s_resources", category),
-			Help: fmt.Sprintf("proof of %s", category),
+	// Initialize a metric for every registered check.
+	for _, check := range common.GetChecks() {
+		name := check.Name()
+		promMetrics[name] = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: fmt.Sprintf("solskin_%s_resources", strings.Replace(name, "-", "_", -1)),
+			Help: check.Description(),
 		}, []string{"name", "namespace", "resource_type"})
-		prometheus.MustRegister(promMetrics[category])
+		prometheus.MustRegister(promMetrics[name])
 	}
 }
 
@@ -64,10 +62,10 @@ func (s Service) Start() {
 
 // Called when one of the informers detects either a new or updated kubernetes
 // resource, with the object as the input parameter.
-func (s Service) onObjectChange(obj interface{}) {
+func (s Service) onObjectChange(obj interface{}) error {
 	// Determine whether or not the object is eligible for monitoring.
 	if !common.IsEligible(obj, s.Configuration) {
-		return
+		return s.clearAnnotation(obj)
 	}
 
 	objectMeta, ktype := common.GetObjectMeta(obj)
@@ -77,40 +75,59 @@ func (s Service) onObjectChange(obj interface{}) {
 		"resource_type": ktype,
 	}
 
-	// Pull out the podspec from the type of object.
-	spec := common.GetPodSpec(obj)
+	// Determine which checks apply to the resource, skipped checks are not
+	// reported at all.
+	applies := policy.IncludeFunc(obj, s.Configuration)
+	include := func(check string) bool {
+		if !applies(check) {
+			promMetrics[check].Delete(labels)
+			return false
+		}
+		return true
+	}
+
+	failures := []string{}
+	results := []CheckResult{}
+	for _, evaluation := range common.EvaluateChecks(obj, s.Configuration, include) {
+		name := evaluation.Check.Name()
 
-	for _, category := range categories {
 		// Create or retrieve our metric.
-		gauge, err := promMetrics[category].GetMetricWith(labels)
+		gauge, err := promMetrics[name].GetMetricWith(labels)
 		if err != nil {
 			log.Fatal(err)
 		}
 
 		// Set our metric.
-		value := false
-		switch category {
-		case "observability":
-			value = common.HasObservability(objectMeta)
-		case "liveness":
-			value = common.HasLiveness(*spec)
-		case "readiness":
-			value = common.HasReadiness(*spec)
-		case "requests":
-			value = common.HasRequests(*spec)
-		case "limits":
-			value = common.HasLimits(*spec)
+		gauge.Set(common.BooleanToFloat64(evaluation.Result.Passed))
+		results = append(results, CheckResult{
+			Check:  name,
+			Passed: evaluation.Result.Passed,
+			Reason: evaluation.Result.Reason,
+		})
+		if !evaluation.Result.Passed {
+			failures = append(failures, name)
+		}
+	}
+
+	// Let the owners of the resource know which checks it fails, leaving it to
+	// the leader when running multiple replicas.
+	if len(failures) > 0 && leader.IsLeader() {
+		message := fmt.Sprintf("Resource does not meet %s requirements", strings.Join(failures, ", "))
+		notifier.Publish(notifier.NewNotification(obj, notifier.TypeViolation, failures, message))
+		err := common.RecordEventWithOwner(obj, core.EventTypeWarning, "FailedChecks", message)
+		if err != nil {
+			return fmt.Errorf("could not record event: %s", err)
 		}
-		gauge.Set(common.BooleanToFloat64(value))
 	}
+	return s.annotate(obj, results)
 }
 
 // Called when one of the informers detects a deleted kubernetes resource,
 // with the object as the input parameter.
-func (s Service) onObjectDelete(obj interface{}) {
+func (s Service) onObjectDelete(obj interface{}) error {
 	// Determine whether or not the object is eligible for monitoring.
 	if !common.IsEligible(obj, s.Configuration) {
-		return
+		return nil
 	}
 
 	objectMeta, ktype := common.GetObjectMeta(obj)
@@ -123,4 +140,5 @@ func (s Service) onObjectDelete(obj interface{}) {
 	for _, metric := range promMetrics {
 		metric.Delete(labels)
 	}
+	return nil
 }
@@ -1,16 +1,21 @@
 package exporter
 
 import (
+	"context"
+	"encoding/json"
 	"github.com/ccpgames/kube-solskin-controller/metrics"
-	"github.com/kubernetes/client-go/kubernetes/fake"
 	"github.com/micro/go-config"
+	"github.com/micro/go-config/source/env"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
 	apps "k8s.io/api/apps/v1"
 	core "k8s.io/api/core/v1"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"reflect"
 	"testing"
 	"time"
@@ -101,7 +106,7 @@ func TestObservability(t *testing.T) {
 			},
 		},
 		MetricsTest{
-			Expected: 1.0,
+			Expected: 0.0,
 			Name:     "solskin_observability_resources",
 			Labels: map[string]string{
 				"name":          "with-false-obs",
@@ -133,6 +138,47 @@ func TestObservability(t *testing.T) {
 	checkMetrics(t, tests)
 }
 
+func TestAnnotate(t *testing.T) {
+	os.Setenv("SOLSKIN_EXPORTER_ANNOTATE", "true")
+	defer os.Unsetenv("SOLSKIN_EXPORTER_ANNOTATE")
+	cfg := config.NewConfig()
+	cfg.Load(env.NewSource(env.WithStrippedPrefix("SOLSKIN")))
+
+	pod := &core.Pod{ObjectMeta: meta.ObjectMeta{Name: "app", Namespace: "default"}}
+	client := fake.NewSimpleClientset(pod)
+	service := Service{Client: client, Configuration: cfg}
+
+	results := []CheckResult{
+		CheckResult{Check: "liveness", Passed: false, Reason: "container [app] has no liveness probe"},
+		CheckResult{Check: "readiness", Passed: true},
+	}
+	assert.Nil(t, service.annotate(pod, results))
+
+	annotated, err := client.CoreV1().Pods("default").Get(context.TODO(), "app", meta.GetOptions{})
+	assert.Nil(t, err)
+	compliance := Compliance{}
+	assert.Nil(t, json.Unmarshal([]byte(annotated.Annotations[ComplianceAnnotation]), &compliance))
+	assert.Exactly(t, results, compliance.Checks)
+	assert.NotEmpty(t, compliance.EvaluatedAt)
+
+	// Unchanged results should not patch the resource again.
+	patches := len(client.Actions())
+	assert.Nil(t, service.annotate(annotated, results))
+	assert.Len(t, client.Actions(), patches)
+
+	// Changed results should.
+	results[0].Passed = true
+	results[0].Reason = ""
+	assert.Nil(t, service.annotate(annotated, results))
+	assert.Len(t, client.Actions(), patches+1)
+
+	// Nothing is written unless enabled.
+	service.Configuration = config.NewConfig()
+	results[1].Passed = false
+	assert.Nil(t, service.annotate(annotated, results))
+	assert.Len(t, client.Actions(), patches+1)
+}
+
 // A helper function to start the prometheus service, send a request, and check
 // the value of a specific metric.
 func checkMetrics(t *testing.T, tests []MetricsTest) {
@@ -0,0 +1,159 @@
+package leader
+
+import (
+	"context"
+	"github.com/ccpgames/kube-solskin-controller/common"
+	"github.com/ccpgames/kube-solskin-controller/queue"
+	"github.com/micro/go-config"
+	"github.com/prometheus/client_golang/prometheus"
+	"io/ioutil"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// File holding the namespace of the pod when running inside a cluster.
+const namespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// Whether or not this replica is the leader, every replica is the leader until
+// leader election is started.
+var leadership = struct {
+	sync.RWMutex
+	leader bool
+}{leader: true}
+
+var leaderMetric = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Help: "Whether or not this replica is the leader.",
+		Name: "solskin_leader",
+	},
+)
+
+// IsLeader determines whether or not this replica is the leader, and thus
+// responsible for suppressing resources and sending notifications.
+func IsLeader() bool {
+	leadership.RLock()
+	defer leadership.RUnlock()
+	return leadership.leader
+}
+
+// Helper function to update the leadership of this replica.
+func setLeader(leader bool) {
+	leadership.Lock()
+	defer leadership.Unlock()
+	if leader != leadership.leader {
+		if leader {
+			log.Println("became the leader")
+		} else {
+			log.Println("stopped being the leader")
+		}
+	}
+	leadership.leader = leader
+	leaderMetric.Set(common.BooleanToFloat64(leader))
+}
+
+// Service is the base service for the leader election service.
+type Service struct {
+	Client        kubernetes.Interface
+	Configuration config.Config
+}
+
+// GetSlug returns the slug used for the configuration section.
+func (s Service) GetSlug() string {
+	return "leader"
+}
+
+// GenerateEventHandlers returns all event handlers used by this service.
+func (s Service) GenerateEventHandlers() []queue.Handlers {
+	return []queue.Handlers{}
+}
+
+// Init registers prometheus metrics for the leader election service.
+func (s Service) Init() {
+	prometheus.MustRegister(leaderMetric)
+}
+
+// Start will take part in leader election, if enabled.
+func (s Service) Start() {
+	if !s.Configuration.Get(s.GetSlug(), "enabled").Bool(false) {
+		log.Println("leader election disabled, acting as the leader")
+		setLeader(true)
+		return
+	}
+
+	cfg := s.electionConfig()
+	e, err := leaderelection.NewLeaderElector(cfg)
+	if err != nil {
+		log.Fatalf("invalid leader election configuration: %s", err)
+	}
+
+	lock := cfg.Lock.(*resourcelock.LeaseLock)
+	log.Printf("starting leader election for lease [%s/%s] as [%s]", lock.LeaseMeta.Namespace, lock.LeaseMeta.Name, lock.Identity())
+	setLeader(false)
+
+	// A leader that could not renew the lease in time stops leading, and goes
+	// back to competing for the lease.
+	go func() {
+		for {
+			e.Run(context.Background())
+		}
+	}()
+}
+
+// Helper function to build the leader election configuration, competing for
+// the lease with the other replicas.
+func (s Service) electionConfig() leaderelection.LeaderElectionConfig {
+	cslug := s.GetSlug()
+	hostname, _ := os.Hostname()
+	name := s.Configuration.Get(cslug, "name").String("solskin")
+
+	return leaderelection.LeaderElectionConfig{
+		Name: name,
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta: meta.ObjectMeta{
+				Name:      name,
+				Namespace: s.Configuration.Get(cslug, "namespace").String(Namespace()),
+			},
+			Client: s.Client.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{
+				Identity: s.Configuration.Get(cslug, "identity").String(hostname),
+			},
+		},
+		LeaseDuration: s.duration("lease", 15*time.Second),
+		RenewDeadline: s.duration("renew", 10*time.Second),
+		RetryPeriod:   s.duration("retry", 2*time.Second),
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(context.Context) { setLeader(true) },
+			OnStoppedLeading: func() { setLeader(false) },
+		},
+	}
+}
+
+// Helper function to parse a duration from the configuration.
+func (s Service) duration(key string, fallback time.Duration) time.Duration {
+	value := s.Configuration.Get(s.GetSlug(), key).String(fallback.String())
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("could not parse leader %s duration, value given: [%s]", key, value)
+		log.Printf("defaulting to %s", fallback)
+		return fallback
+	}
+	return d
+}
+
+// Namespace returns the namespace we're running in, defaulting to the default
+// namespace outside of a cluster.
+func Namespace() string {
+	if data, err := ioutil.ReadFile(namespaceFile); err == nil {
+		if ns := strings.TrimSpace(string(data)); ns != "" {
+			return ns
+		}
+	}
+	return "default"
+}
@@ -0,0 +1,37 @@
+package leader
+
+import (
+	"context"
+	config "github.com/micro/go-config"
+	"github.com/micro/go-config/source/env"
+	"github.com/stretchr/testify/assert"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestElection(t *testing.T) {
+	defer setLeader(true)
+	os.Setenv("SOLSKIN_LEADER_ENABLED", "true")
+	os.Setenv("SOLSKIN_LEADER_NAMESPACE", "solskin")
+	os.Setenv("SOLSKIN_LEADER_IDENTITY", "first")
+	defer os.Unsetenv("SOLSKIN_LEADER_ENABLED")
+	defer os.Unsetenv("SOLSKIN_LEADER_NAMESPACE")
+	defer os.Unsetenv("SOLSKIN_LEADER_IDENTITY")
+	cfg := config.NewConfig()
+	cfg.Load(env.NewSource(env.WithStrippedPrefix("SOLSKIN")))
+
+	client := fake.NewSimpleClientset()
+	s := Service{Client: client, Configuration: cfg}
+
+	// The replica only leads once it has acquired the lease.
+	s.Start()
+	assert.Eventually(t, IsLeader, 5*time.Second, 10*time.Millisecond)
+
+	lease, err := client.CoordinationV1().Leases("solskin").Get(context.TODO(), "solskin", meta.GetOptions{})
+	assert.Nil(t, err)
+	assert.Exactly(t, "first", *lease.Spec.HolderIdentity)
+	assert.Exactly(t, int32(15), *lease.Spec.LeaseDurationSeconds)
+}
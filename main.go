@@ -1,19 +1,32 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
-	"github.com/kubernetes/client-go/informers"
 	"github.com/micro/go-config/source/env"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/tools/cache"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/ccpgames/kube-solskin-controller/common"
 	"github.com/ccpgames/kube-solskin-controller/exporter"
+	"github.com/ccpgames/kube-solskin-controller/leader"
 	"github.com/ccpgames/kube-solskin-controller/metrics"
+	"github.com/ccpgames/kube-solskin-controller/monitor"
+	"github.com/ccpgames/kube-solskin-controller/notifier"
+	"github.com/ccpgames/kube-solskin-controller/policy"
+	"github.com/ccpgames/kube-solskin-controller/queue"
+	"github.com/ccpgames/kube-solskin-controller/report"
 	"github.com/ccpgames/kube-solskin-controller/suppressor"
+	"github.com/ccpgames/kube-solskin-controller/webhook"
 	config "github.com/micro/go-config"
 
 	"k8s.io/client-go/kubernetes"
@@ -23,34 +36,38 @@ import (
 
 // SolskinService general service interface.
 type SolskinService interface {
-	GenerateEventHandlers() []cache.ResourceEventHandlerFuncs
+	GenerateEventHandlers() []queue.Handlers
 	GetSlug() string
 	Init()
 	Start()
 }
 
+// InformerService is a service watching resources of its own, its informers
+// are run and synced along with the namespace informer before any resource is
+// handled.
+type InformerService interface {
+	Informers() []cache.SharedIndexInformer
+}
+
 func main() {
 	// Load up our configuration from the environment.
 	cfg := config.NewConfig()
 	cfg.Load(env.NewSource(env.WithStrippedPrefix("SOLSKIN")))
 
-	// Try to pull the in-cluster configuration first.
-	log.Println("attempting to pull in-cluster kube configuration")
-	kubecfg, err := rest.InClusterConfig()
-	if err != nil {
-		log.Println("service running outside of kube cluster")
-		log.Println("attempting to pull kube cluster info from local filesystem")
-
-		// If we're not in a cluster then pull configuration from local filesystem.
-		kubeFile := fmt.Sprintf("%s/.kube/config", os.Getenv("HOME"))
-		kubeconfig := cfg.Get("cluster", "kubecfg").String(kubeFile)
-
-		kubecfg, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
-		if err != nil {
-			log.Fatal(err)
+	// Run one-shot commands instead of the controller when asked to.
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "audit":
+			os.Exit(audit(os.Args[2:], cfg))
+		case "lint":
+			os.Exit(lint(os.Args[2:], cfg))
 		}
 	}
-	log.Println("kube configuration determined")
+
+	kubecfg, err := kubeConfig(cfg, "")
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	client, err := kubernetes.NewForConfig(kubecfg)
 	if err != nil {
@@ -58,16 +75,24 @@ func main() {
 	}
 	log.Println("kube configuration is valid")
 
-	stopper := make(chan os.Signal)
+	stopper := make(chan os.Signal, 1)
 
 	signal.Notify(stopper, syscall.SIGTERM)
 	signal.Notify(stopper, syscall.SIGINT)
 
+	// Post the events of every service through a single recorder.
+	common.SetEventRecorder(common.NewEventRecorder(client))
+
 	// Create our services.
 	services := []SolskinService{
+		leader.Service{Client: client, Configuration: cfg},
 		exporter.Service{Client: client, Configuration: cfg},
 		suppressor.Service{Client: client, Configuration: cfg},
 		metrics.Service{Client: client, Configuration: cfg},
+		notifier.Service{Client: client, Configuration: cfg},
+		policy.Service{Client: client, Configuration: cfg, RESTConfig: kubecfg},
+		monitor.Service{Client: client, Configuration: cfg, RESTConfig: kubecfg},
+		webhook.Service{Client: client, Configuration: cfg},
 	}
 
 	s, err := StartServices(services, client, cfg)
@@ -80,6 +105,120 @@ func main() {
 	<-stopper
 }
 
+// Helper function to determine the kube configuration, from the given file if
+// any, otherwise from within the cluster, falling back to the local filesystem.
+func kubeConfig(cfg config.Config, kubeconfig string) (*rest.Config, error) {
+	if kubeconfig != "" {
+		return clientcmd.BuildConfigFromFlags("", kubeconfig)
+	}
+
+	// Try to pull the in-cluster configuration first.
+	log.Println("attempting to pull in-cluster kube configuration")
+	kubecfg, err := rest.InClusterConfig()
+	if err != nil {
+		log.Println("service running outside of kube cluster")
+		log.Println("attempting to pull kube cluster info from local filesystem")
+
+		// If we're not in a cluster then pull configuration from local filesystem.
+		kubeFile := fmt.Sprintf("%s/.kube/config", os.Getenv("HOME"))
+		kubeconfig = cfg.Get("cluster", "kubecfg").String(kubeFile)
+
+		kubecfg, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+	log.Println("kube configuration determined")
+	return kubecfg, nil
+}
+
+// Runs the audit command, which reports how every eligible resource in the
+// cluster fares against the checks once, returning the exit code. The exit code
+// is 1 when the number of violations exceeds the threshold, and 2 on errors.
+func audit(args []string, cfg config.Config) int {
+	flags := flag.NewFlagSet("audit", flag.ContinueOnError)
+	kubeconfig := flags.String("kubeconfig", "", "path to the kubeconfig file, defaults to the in-cluster configuration or ~/.kube/config")
+	namespace := flags.String("namespace", "", "only audit the given namespace")
+	format := flags.String("format", "table", fmt.Sprintf("output format, one of: %s", strings.Join(report.Formats(), ", ")))
+	threshold := flags.Int("threshold", 0, "number of violations tolerated before exiting with a non-zero exit code")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	kubecfg, err := kubeConfig(cfg, *kubeconfig)
+	if err != nil {
+		log.Printf("could not determine kube configuration: %s", err)
+		return 2
+	}
+
+	client, err := kubernetes.NewForConfig(kubecfg)
+	if err != nil {
+		log.Printf("could not create kube client: %s", err)
+		return 2
+	}
+
+	// Only read the policy custom resources when the controller would.
+	var policies rest.Interface
+	if cfg.Get("policy", "enabled").Bool(false) {
+		if policies, err = policy.NewRESTClient(kubecfg); err != nil {
+			log.Printf("could not create policy client: %s", err)
+			return 2
+		}
+	}
+
+	r, err := report.Audit(client, policies, cfg, *namespace)
+	if err != nil {
+		log.Printf("could not audit cluster: %s", err)
+		return 2
+	}
+
+	return render(r, *format, *threshold)
+}
+
+// Runs the lint command, which reports how the kubernetes manifests in the
+// given files and directories, or standard input, fare against the checks
+// without connecting to a cluster, returning the exit code. The exit code is 1
+// when the number of violations exceeds the threshold, and 2 on errors.
+func lint(args []string, cfg config.Config) int {
+	flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	format := flags.String("format", "table", fmt.Sprintf("output format, one of: %s", strings.Join(report.Formats(), ", ")))
+	threshold := flags.Int("threshold", 0, "number of violations tolerated before exiting with a non-zero exit code")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{report.Stdin}
+	}
+
+	r, errs := report.Lint(paths, os.Stdin, cfg)
+	for _, err := range errs {
+		log.Printf("could not lint manifest: %s", err)
+	}
+
+	code := render(r, *format, *threshold)
+	if len(errs) > 0 {
+		return 2
+	}
+	return code
+}
+
+// Helper function to print the report, returning the exit code of a command
+// with the given violation threshold.
+func render(r report.Report, format string, threshold int) int {
+	if err := report.Render(os.Stdout, r, format); err != nil {
+		log.Println(err)
+		return 2
+	}
+
+	if violations := r.Violations(); violations > threshold {
+		log.Printf("%d violation(s) found, exceeding the threshold of %d", violations, threshold)
+		return 1
+	}
+	return 0
+}
+
 // StartServices will initialize and kick off all given services with the
 // proper set of informers.
 func StartServices(
@@ -88,21 +227,18 @@ func StartServices(
 	cfg config.Config,
 ) (chan struct{}, error) {
 	// Initialize services here.
+	queue.RegisterMetrics()
 	for _, service := range services {
 		service.Init()
 	}
 
 	// Determine our resync period, defaulting to five minutes.
-	resyncValue := cfg.Get("informers", "resync").String("5m")
-	resync, err := time.ParseDuration(resyncValue)
-	if err != nil {
-		log.Printf("could not parse resync duration, value given: [%s]", resyncValue)
-		log.Println("defaulting to 5 minute resync period")
-		resync = time.Duration(5 * time.Minute)
-	}
+	resync := parseDuration(cfg, "5m", "informers", "resync")
 
 	// Create our informers.
 	factory := informers.NewSharedInformerFactory(client, resync)
+	namespaces := factory.Core().V1().Namespaces().Informer()
+	namespaces.AddEventHandler(common.NamespaceEventHandlers())
 	informers := []cache.SharedIndexInformer{
 		factory.Apps().V1().DaemonSets().Informer(),
 		factory.Apps().V1().Deployments().Informer(),
@@ -111,27 +247,103 @@ func StartServices(
 		factory.Core().V1().Pods().Informer(),
 	}
 
-	handlers := make([]cache.ResourceEventHandlerFuncs, 0)
+	// Look up the owners of resources from the informer caches, which needs the
+	// replicaset informer on top of those of the resources we handle.
+	common.SetOwnerListers(factory)
+	replicaSets := factory.Apps().V1().ReplicaSets().Informer()
+
+	// Give every service with handlers its own queue, so that a slow service
+	// doesn't hold up the informers or the other services.
+	queues := make([]*queue.Queue, 0)
 	for _, service := range services {
-		handlers = append(handlers, service.GenerateEventHandlers()...)
-	}
+		handlers := service.GenerateEventHandlers()
+		if len(handlers) == 0 {
+			continue
+		}
 
-	for _, informer := range informers {
-		for _, handler := range handlers {
-			informer.AddEventHandler(handler)
+		q := queue.New(
+			service.GetSlug(),
+			handlers,
+			cfg.Get("queue", "retries").Int(5),
+			queue.NewRateLimiter(
+				parseDuration(cfg, "1s", "queue", "backoff", "base"),
+				parseDuration(cfg, "5m", "queue", "backoff", "max"),
+				cfg.Get("queue", "limit", "qps").Float64(10),
+				cfg.Get("queue", "limit", "burst").Int(100),
+			),
+		)
+		queues = append(queues, q)
+		for _, informer := range informers {
+			informer.AddEventHandler(q.EventHandlers())
 		}
+
+		// Replicasets managed by a deployment are handled through it, so only
+		// bare replicasets are handled, e.g. to restore them once suppressed.
+		replicaSets.AddEventHandler(cache.FilteringResourceEventHandler{
+			FilterFunc: isUncontrolled,
+			Handler:    q.EventHandlers(),
+		})
 	}
 
 	// Spool up services here.
+	prerequisites := []cache.SharedIndexInformer{namespaces, replicaSets}
 	for _, service := range services {
+		if is, ok := service.(InformerService); ok {
+			prerequisites = append(prerequisites, is.Informers()...)
+		}
 		service.Start()
 	}
 
-	// Start our informers.
+	// Start our informers, making sure we know about every namespace's policy,
+	// every resource's owner, and the resources watched by the services before
+	// handling any resources. Resources seen in the meantime wait in the queues.
 	s := make(chan struct{})
-	for _, informer := range informers {
+	synced := []cache.InformerSynced{}
+	for _, informer := range append(prerequisites, informers...) {
 		go informer.Run(s)
+		synced = append(synced, informer.HasSynced)
+	}
+
+	// Give up on informers that can't sync, e.g. because we lack permission to
+	// list their resources, rather than waiting for them forever.
+	timeout := parseDuration(cfg, "2m", "informers", "sync", "timeout")
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if !cache.WaitForCacheSync(ctx.Done(), synced...) {
+		close(s)
+		return nil, fmt.Errorf("could not sync informers within %s", timeout)
+	}
+	workers := cfg.Get("queue", "workers").Int(2)
+	for _, q := range queues {
+		q.Start(workers, s)
 	}
 
 	return s, nil
 }
+
+// Helper function to determine if the resource has no controller, including
+// the last known state of deleted resources.
+func isUncontrolled(obj interface{}) bool {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	m, err := apimeta.Accessor(obj)
+	if err != nil {
+		return false
+	}
+	return meta.GetControllerOf(m) == nil
+}
+
+// Helper function to parse a duration from the configuration, falling back to
+// the given default.
+func parseDuration(cfg config.Config, fallback string, path ...string) time.Duration {
+	value := cfg.Get(path...).String(fallback)
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("could not parse %s duration, value given: [%s]", strings.Join(path, " "), value)
+		log.Printf("defaulting to %s", fallback)
+		d, _ = time.ParseDuration(fallback)
+	}
+	return d
+}
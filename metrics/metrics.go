@@ -2,10 +2,10 @@ package metrics
 
 import (
 	"fmt"
+	"github.com/ccpgames/kube-solskin-controller/queue"
 	"github.com/micro/go-config"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/cache"
 	"log"
 	"net/http"
 )
@@ -22,8 +22,8 @@ func (s Service) GetSlug() string {
 }
 
 // GenerateEventHandlers returns all event handlers used by this service.
-func (s Service) GenerateEventHandlers() []cache.ResourceEventHandlerFuncs {
-	return []cache.ResourceEventHandlerFuncs{}
+func (s Service) GenerateEventHandlers() []queue.Handlers {
+	return []queue.Handlers{}
 }
 
 // Init doesn't need to do anything for this service.
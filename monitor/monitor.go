@@ -0,0 +1,166 @@
+package monitor
+
+import (
+	"github.com/ccpgames/kube-solskin-controller/common"
+	"github.com/ccpgames/kube-solskin-controller/queue"
+	"github.com/micro/go-config"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"log"
+)
+
+// Service is the base service for the monitor service, which accepts
+// prometheus-operator monitors as proof of observability.
+type Service struct {
+	Client        kubernetes.Interface
+	Configuration config.Config
+	RESTConfig    *rest.Config
+}
+
+// GetSlug returns the slug used for the configuration section.
+func (s Service) GetSlug() string {
+	return "monitor"
+}
+
+// GenerateEventHandlers returns all event handlers used by this service.
+func (s Service) GenerateEventHandlers() []queue.Handlers {
+	return []queue.Handlers{}
+}
+
+// Init doesn't need to do anything for this service.
+func (s Service) Init() {
+	// do nothing
+}
+
+// Start doesn't need to do anything for this service, its informers are run
+// along with the other informers.
+func (s Service) Start() {
+	// do nothing
+}
+
+// ServiceMonitors is the resource of the prometheus-operator ServiceMonitor
+// custom resource.
+var ServiceMonitors = schema.GroupVersionResource{Group: "monitoring.coreos.com", Version: "v1", Resource: "servicemonitors"}
+
+// PodMonitors is the resource of the prometheus-operator PodMonitor custom
+// resource.
+var PodMonitors = schema.GroupVersionResource{Group: "monitoring.coreos.com", Version: "v1", Resource: "podmonitors"}
+
+// Mapping of the kinds of the prometheus-operator custom resources to the
+// kinds of monitors kept in the monitor store.
+var kinds = map[string]string{
+	"ServiceMonitor": common.KindServiceMonitor,
+	"PodMonitor":     common.KindPodMonitor,
+}
+
+// Informers returns the informers watching the ServiceMonitor and PodMonitor
+// custom resources, along with the services they select, if enabled.
+func (s Service) Informers() []cache.SharedIndexInformer {
+	if !s.Configuration.Get(s.GetSlug(), "enabled").Bool(false) {
+		log.Println("prometheus-operator monitors disabled")
+		return nil
+	}
+
+	client, err := dynamic.NewForConfig(s.RESTConfig)
+	if err != nil {
+		log.Printf("could not create monitor client: %s", err)
+		return nil
+	}
+
+	log.Println("watching prometheus-operator monitors")
+	services := cache.NewSharedIndexInformer(
+		cache.NewListWatchFromClient(s.Client.CoreV1().RESTClient(), "services", meta.NamespaceAll, fields.Everything()),
+		&core.Service{},
+		0,
+		cache.Indexers{},
+	)
+	services.AddEventHandler(common.ServiceEventHandlers())
+
+	informers := []cache.SharedIndexInformer{services}
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, 0, meta.NamespaceAll, nil)
+	for _, resource := range []schema.GroupVersionResource{ServiceMonitors, PodMonitors} {
+		informer := factory.ForResource(resource).Informer()
+		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    func(obj interface{}) { setMonitor(obj) },
+			UpdateFunc: func(_, obj interface{}) { setMonitor(obj) },
+			DeleteFunc: func(obj interface{}) { deleteMonitor(obj) },
+		})
+		informers = append(informers, informer)
+	}
+	return informers
+}
+
+// ToMonitor converts a ServiceMonitor or PodMonitor into the monitor kept in
+// the monitor store.
+func ToMonitor(obj interface{}) (common.Monitor, bool) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return common.Monitor{}, false
+	}
+	kind, ok := kinds[u.GetKind()]
+	if !ok {
+		return common.Monitor{}, false
+	}
+
+	selector, err := toSelector(u)
+	if err != nil {
+		log.Printf("could not parse selector of %s [%s/%s]: %s", kind, u.GetNamespace(), u.GetName(), err)
+		return common.Monitor{}, false
+	}
+
+	any, _, _ := unstructured.NestedBool(u.Object, "spec", "namespaceSelector", "any")
+	namespaces, _, _ := unstructured.NestedStringSlice(u.Object, "spec", "namespaceSelector", "matchNames")
+	return common.Monitor{
+		Kind:         kind,
+		Name:         u.GetName(),
+		Namespace:    u.GetNamespace(),
+		Selector:     selector,
+		AnyNamespace: any,
+		Namespaces:   namespaces,
+	}, true
+}
+
+// Helper function to parse the label selector of a monitor, which selects
+// everything when missing.
+func toSelector(u *unstructured.Unstructured) (labels.Selector, error) {
+	selector := meta.LabelSelector{}
+	value, found, err := unstructured.NestedMap(u.Object, "spec", "selector")
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(value, &selector); err != nil {
+			return nil, err
+		}
+	}
+	return meta.LabelSelectorAsSelector(&selector)
+}
+
+// Helper function to add or update a monitor in the monitor store.
+func setMonitor(obj interface{}) {
+	if m, ok := ToMonitor(obj); ok {
+		common.SetMonitor(m)
+	}
+}
+
+// Helper function to remove a monitor from the monitor store.
+func deleteMonitor(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		if kind, ok := kinds[u.GetKind()]; ok {
+			common.DeleteMonitor(kind, u.GetNamespace(), u.GetName())
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package monitor
+
+import (
+	"github.com/ccpgames/kube-solskin-controller/common"
+	"github.com/stretchr/testify/assert"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"testing"
+)
+
+func monitor(kind string, name string, spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "monitoring.coreos.com/v1",
+		"kind":       kind,
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": "monitoring",
+		},
+		"spec": spec,
+	}}
+}
+
+func TestToMonitor(t *testing.T) {
+	sm := monitor("ServiceMonitor", "web", map[string]interface{}{
+		"selector": map[string]interface{}{
+			"matchLabels": map[string]interface{}{"app": "web"},
+		},
+		"namespaceSelector": map[string]interface{}{
+			"matchNames": []interface{}{"team"},
+		},
+	})
+	m, ok := ToMonitor(sm)
+	assert.True(t, ok)
+	assert.Exactly(t, common.KindServiceMonitor, m.Kind)
+	assert.Exactly(t, "monitoring", m.Namespace)
+	assert.Exactly(t, []string{"team"}, m.Namespaces)
+	assert.Exactly(t, "app=web", m.Selector.String())
+
+	pm := monitor("PodMonitor", "all", map[string]interface{}{
+		"namespaceSelector": map[string]interface{}{"any": true},
+	})
+	m, ok = ToMonitor(pm)
+	assert.True(t, ok)
+	assert.Exactly(t, common.KindPodMonitor, m.Kind)
+	assert.True(t, m.AnyNamespace)
+	assert.True(t, m.Selector.Empty())
+
+	// Monitors with invalid selectors are ignored.
+	pm.Object["spec"].(map[string]interface{})["selector"] = map[string]interface{}{
+		"matchExpressions": []interface{}{
+			map[string]interface{}{"key": "app", "operator": "Unknown"},
+		},
+	}
+	_, ok = ToMonitor(pm)
+	assert.False(t, ok)
+
+	_, ok = ToMonitor(monitor("Probe", "other", map[string]interface{}{}))
+	assert.False(t, ok)
+	_, ok = ToMonitor(&meta.ObjectMeta{})
+	assert.False(t, ok)
+}
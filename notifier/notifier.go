@@ -1,11 +1,230 @@
 package notifier
 
 import (
+	"fmt"
+	"github.com/ccpgames/kube-solskin-controller/common"
+	"github.com/ccpgames/kube-solskin-controller/leader"
+	"github.com/ccpgames/kube-solskin-controller/queue"
+	"github.com/micro/go-config"
+	"github.com/patrickmn/go-cache"
+	"github.com/prometheus/client_golang/prometheus"
 	"k8s.io/client-go/kubernetes"
-	"os"
+	"log"
+	"regexp"
+	"strings"
+	"time"
 )
 
-// Start ...
-func Start(client kubernetes.Interface, stopper <-chan os.Signal) {
-	<-stopper
+// Type is an enumeration of the kinds of notifications we send.
+type Type string
+
+const (
+	// TypeViolation is sent when a resource does not meet standards.
+	TypeViolation Type = "violation"
+
+	// TypeScheduled is sent when a resource is scheduled for suppression.
+	TypeScheduled Type = "scheduled"
+
+	// TypeSuppression is sent when a resource has been suppressed.
+	TypeSuppression Type = "suppression"
+
+	// TypeRestoration is sent when a suppressed resource has been restored.
+	TypeRestoration Type = "restoration"
+)
+
+// Notification represents a single violation or suppression of a kubernetes
+// resource.
+type Notification struct {
+	Type         Type      `json:"type"`
+	Name         string    `json:"name"`
+	Namespace    string    `json:"namespace"`
+	ResourceType string    `json:"resource_type"`
+	UID          string    `json:"uid"`
+	Checks       []string  `json:"checks,omitempty"`
+	Message      string    `json:"message"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+// Sink is a backend that notifications can be sent to.
+type Sink interface {
+	Name() string
+	Send(n Notification) error
+}
+
+// Route sends the notifications of the namespaces matching the pattern to the
+// sink.
+type Route struct {
+	Sink       Sink
+	Namespaces *regexp.Regexp
+}
+
+// Queue of notifications waiting to be sent.
+var notifications = make(chan Notification, 1024)
+
+var sentNotificationsMetric = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Help: "Counter of notifications sent, by sink and result.",
+		Name: "solskin_notifications",
+	},
+	[]string{
+		"sink",
+		"result",
+	},
+)
+
+// NewNotification creates a notification about the given kubernetes resource.
+func NewNotification(obj interface{}, ntype Type, checks []string, message string) Notification {
+	m, ktype := common.GetObjectMeta(obj)
+	return Notification{
+		Type:         ntype,
+		Name:         m.GetName(),
+		Namespace:    m.GetNamespace(),
+		ResourceType: ktype,
+		UID:          string(m.GetUID()),
+		Checks:       checks,
+		Message:      message,
+		Timestamp:    time.Now().UTC(),
+	}
+}
+
+// Publish queues the notification to be sent by the notifier service, the
+// notification is dropped if the queue is full.
+func Publish(n Notification) {
+	select {
+	case notifications <- n:
+	default:
+		log.Printf("notification queue is full, dropping notification for [%s:%s.%s]", n.ResourceType, n.Name, n.Namespace)
+	}
+}
+
+// Service is the base service for the notifier service.
+type Service struct {
+	Client        kubernetes.Interface
+	Configuration config.Config
+}
+
+// GetSlug returns the slug used for the configuration section.
+func (s Service) GetSlug() string {
+	return "notifier"
+}
+
+// GenerateEventHandlers returns all event handlers used by this service.
+func (s Service) GenerateEventHandlers() []queue.Handlers {
+	return []queue.Handlers{}
+}
+
+// Init registers prometheus metrics for the notifier service.
+func (s Service) Init() {
+	prometheus.MustRegister(sentNotificationsMetric)
+}
+
+// Start will fan out published notifications to the configured sinks.
+func (s Service) Start() {
+	routes := s.routes()
+	if len(routes) == 0 {
+		log.Println("no notification sinks configured")
+	}
+
+	// Determine our deduplication window, defaulting to one hour.
+	dedupValue := s.Configuration.Get(s.GetSlug(), "dedup").String("1h")
+	dedup, err := time.ParseDuration(dedupValue)
+	if err != nil {
+		log.Printf("could not parse dedup duration, value given: [%s]", dedupValue)
+		log.Println("defaulting to 1 hour dedup window")
+		dedup = time.Duration(1 * time.Hour)
+	}
+	sent := cache.New(dedup, 2*dedup)
+
+	go func() {
+		for n := range notifications {
+			// Only the leader sends notifications when running multiple
+			// replicas.
+			if !leader.IsLeader() {
+				continue
+			}
+			dispatch(n, routes, sent)
+		}
+	}()
+}
+
+// Helper function to build the routes of every configured sink.
+func (s Service) routes() []Route {
+	cslug := s.GetSlug()
+	sinks := []Sink{}
+
+	if url := s.Configuration.Get(cslug, "webhook", "url").String(""); url != "" {
+		sinks = append(sinks, WebhookSink{URL: url})
+	}
+
+	if url := s.Configuration.Get(cslug, "slack", "url").String(""); url != "" {
+		sinks = append(sinks, SlackSink{URL: url})
+	}
+
+	if host := s.Configuration.Get(cslug, "smtp", "host").String(""); host != "" {
+		to := recipients(s.Configuration.Get(cslug, "smtp", "to").String(""))
+		if len(to) == 0 {
+			log.Println("no recipients configured for smtp sink, not sending email notifications")
+		} else {
+			sinks = append(sinks, SMTPSink{
+				Host:     host,
+				Port:     s.Configuration.Get(cslug, "smtp", "port").Int(25),
+				Username: s.Configuration.Get(cslug, "smtp", "username").String(""),
+				Password: s.Configuration.Get(cslug, "smtp", "password").String(""),
+				From:     s.Configuration.Get(cslug, "smtp", "from").String("solskin@localhost"),
+				To:       to,
+			})
+		}
+	}
+
+	routes := []Route{}
+	for _, sink := range sinks {
+		p := s.Configuration.Get(cslug, sink.Name(), "namespace").String(".*")
+		namespaces, err := regexp.Compile(p)
+		if err != nil {
+			log.Printf("could not compile namespace pattern for %s sink, value given: [%s]", sink.Name(), p)
+			continue
+		}
+
+		log.Printf("sending notifications for namespaces matching [%s] to %s sink", p, sink.Name())
+		routes = append(routes, Route{Sink: sink, Namespaces: namespaces})
+	}
+	return routes
+}
+
+// Helper function to split the comma separated email recipients, skipping
+// empty entries.
+func recipients(to string) []string {
+	found := []string{}
+	for _, recipient := range strings.Split(to, ",") {
+		if recipient = strings.TrimSpace(recipient); recipient != "" {
+			found = append(found, recipient)
+		}
+	}
+	return found
+}
+
+// Helper function to send a notification to every matching route, skipping
+// notifications that have already been sent within the dedup window.
+func dispatch(n Notification, routes []Route, sent *cache.Cache) {
+	key := fmt.Sprintf("%s/%s/%s/%s", n.UID, n.Type, strings.Join(n.Checks, ","), n.Message)
+	if _, found := sent.Get(key); found {
+		return
+	}
+	sent.Set(key, true, cache.DefaultExpiration)
+
+	for _, route := range routes {
+		if !route.Namespaces.MatchString(n.Namespace) {
+			continue
+		}
+
+		result := "success"
+		if err := route.Sink.Send(n); err != nil {
+			log.Printf("[%s:%s.%s] could not send notification to %s sink: %s", n.ResourceType, n.Name, n.Namespace, route.Sink.Name(), err)
+			result = "failure"
+		}
+		sentNotificationsMetric.With(map[string]string{
+			"sink":   route.Sink.Name(),
+			"result": result,
+		}).Inc()
+	}
 }
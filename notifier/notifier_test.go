@@ -1 +1,86 @@
 package notifier
+
+import (
+	"encoding/json"
+	"github.com/patrickmn/go-cache"
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// RecordingSink records every notification sent to it.
+type RecordingSink struct {
+	Sent *[]Notification
+}
+
+func (r RecordingSink) Name() string {
+	return "recording"
+}
+
+func (r RecordingSink) Send(n Notification) error {
+	*r.Sent = append(*r.Sent, n)
+	return nil
+}
+
+func TestDispatch(t *testing.T) {
+	sent := []Notification{}
+	routes := []Route{
+		Route{
+			Sink:       RecordingSink{Sent: &sent},
+			Namespaces: regexp.MustCompile("^team-"),
+		},
+	}
+	dedup := cache.New(time.Hour, time.Hour)
+
+	pod := &core.Pod{ObjectMeta: meta.ObjectMeta{Name: "pod", Namespace: "team-a", UID: "a"}}
+	other := &core.Pod{ObjectMeta: meta.ObjectMeta{Name: "pod", Namespace: "other", UID: "b"}}
+
+	// Repeated notifications should only be sent once.
+	for i := 0; i < 3; i++ {
+		dispatch(NewNotification(pod, TypeViolation, []string{"liveness"}, "test"), routes, dedup)
+	}
+	assert.Len(t, sent, 1)
+
+	// A different violation of the same resource should be sent.
+	dispatch(NewNotification(pod, TypeViolation, []string{"readiness"}, "test"), routes, dedup)
+	assert.Len(t, sent, 2)
+
+	// Notifications from other namespaces should not be routed to the sink.
+	dispatch(NewNotification(other, TypeViolation, []string{"liveness"}, "test"), routes, dedup)
+	assert.Len(t, sent, 2)
+}
+
+func TestWebhookSinks(t *testing.T) {
+	bodies := []map[string]interface{}{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies = append(bodies, body)
+	}))
+	defer server.Close()
+
+	pod := &core.Pod{ObjectMeta: meta.ObjectMeta{Name: "pod", Namespace: "default"}}
+	n := NewNotification(pod, TypeSuppression, []string{"liveness"}, "suppressed")
+
+	assert.NoError(t, WebhookSink{URL: server.URL}.Send(n))
+	assert.NoError(t, SlackSink{URL: server.URL}.Send(n))
+	assert.Len(t, bodies, 2)
+
+	// The generic webhook receives the notification itself.
+	assert.Exactly(t, "suppression", bodies[0]["type"])
+	assert.Exactly(t, "pod", bodies[0]["name"])
+
+	// The slack webhook receives a formatted message.
+	assert.Exactly(t, "*suppression* `pod:pod.default`: suppressed", bodies[1]["text"])
+}
+
+func TestRecipients(t *testing.T) {
+	assert.Empty(t, recipients(""))
+	assert.Empty(t, recipients(" , "))
+	assert.Exactly(t, []string{"a@example.com", "b@example.com"}, recipients("a@example.com, ,b@example.com,"))
+}
@@ -0,0 +1,104 @@
+package notifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Client used by the HTTP based sinks.
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// WebhookSink posts notifications as JSON to a generic webhook.
+type WebhookSink struct {
+	URL string
+}
+
+// Name returns the name of the sink, also used for its configuration section.
+func (w WebhookSink) Name() string {
+	return "webhook"
+}
+
+// Send posts the notification to the webhook.
+func (w WebhookSink) Send(n Notification) error {
+	return postJSON(w.URL, n)
+}
+
+// SlackSink posts notifications to a Slack-compatible incoming webhook.
+type SlackSink struct {
+	URL string
+}
+
+// Name returns the name of the sink, also used for its configuration section.
+func (s SlackSink) Name() string {
+	return "slack"
+}
+
+// Send posts the notification to the incoming webhook.
+func (s SlackSink) Send(n Notification) error {
+	return postJSON(s.URL, map[string]string{
+		"text": fmt.Sprintf("*%s* `%s`: %s", n.Type, label(n), n.Message),
+	})
+}
+
+// SMTPSink emails notifications through an SMTP server.
+type SMTPSink struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// Name returns the name of the sink, also used for its configuration section.
+func (s SMTPSink) Name() string {
+	return "smtp"
+}
+
+// Send emails the notification to all recipients.
+func (s SMTPSink) Send(n Notification) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+
+	body := fmt.Sprintf(
+		"From: %s\r\nTo: %s\r\nSubject: [solskin] %s %s\r\n\r\n%s\r\n",
+		s.From,
+		strings.Join(s.To, ", "),
+		n.Type,
+		label(n),
+		n.Message,
+	)
+	addr := fmt.Sprintf("%s:%d", s.Host, s.Port)
+	return smtp.SendMail(addr, auth, s.From, s.To, []byte(body))
+}
+
+// Helper function to post the JSON encoding of the payload to the URL.
+func postJSON(url string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	resp, err := httpClient.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code [%d]", resp.StatusCode)
+	}
+	return nil
+}
+
+// Helper function to format the full label of the notified resource.
+func label(n Notification) string {
+	return fmt.Sprintf("%s:%s.%s", n.ResourceType, n.Name, n.Namespace)
+}
@@ -0,0 +1,280 @@
+package policy
+
+import (
+	"context"
+	"github.com/ccpgames/kube-solskin-controller/common"
+	"github.com/ccpgames/kube-solskin-controller/queue"
+	"github.com/micro/go-config"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"log"
+	"sort"
+	"sync"
+)
+
+// Store of the policies in the cluster, kept up to date by the policy
+// informers.
+var policies = struct {
+	sync.RWMutex
+	namespaced map[string]*SolskinPolicy
+	cluster    map[string]*SolskinClusterPolicy
+}{
+	namespaced: map[string]*SolskinPolicy{},
+	cluster:    map[string]*SolskinClusterPolicy{},
+}
+
+// Service is the base service for the policy service.
+type Service struct {
+	Client        kubernetes.Interface
+	Configuration config.Config
+	RESTConfig    *rest.Config
+}
+
+// GetSlug returns the slug used for the configuration section.
+func (s Service) GetSlug() string {
+	return "policy"
+}
+
+// GenerateEventHandlers returns all event handlers used by this service.
+func (s Service) GenerateEventHandlers() []queue.Handlers {
+	return []queue.Handlers{}
+}
+
+// Init doesn't need to do anything for this service.
+func (s Service) Init() {
+	// do nothing
+}
+
+// Start doesn't need to do anything for this service, its informers are run
+// along with the other informers.
+func (s Service) Start() {
+	// do nothing
+}
+
+// Informers returns the informers watching the policy custom resources if
+// enabled.
+func (s Service) Informers() []cache.SharedIndexInformer {
+	if !s.Configuration.Get(s.GetSlug(), "enabled").Bool(false) {
+		log.Println("policy custom resources disabled")
+		return nil
+	}
+
+	client, err := NewRESTClient(s.RESTConfig)
+	if err != nil {
+		log.Printf("could not create policy client: %s", err)
+		return nil
+	}
+
+	log.Println("watching policy custom resources")
+	namespaced := cache.NewSharedIndexInformer(
+		cache.NewListWatchFromClient(client, "solskinpolicies", meta.NamespaceAll, fields.Everything()),
+		&SolskinPolicy{},
+		0,
+		cache.Indexers{},
+	)
+	namespaced.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { SetPolicy(obj.(*SolskinPolicy)) },
+		UpdateFunc: func(_, obj interface{}) { SetPolicy(obj.(*SolskinPolicy)) },
+		DeleteFunc: func(obj interface{}) {
+			if p, ok := untombstone(obj).(*SolskinPolicy); ok {
+				DeletePolicy(p)
+			}
+		},
+	})
+
+	cluster := cache.NewSharedIndexInformer(
+		cache.NewListWatchFromClient(client, "solskinclusterpolicies", meta.NamespaceAll, fields.Everything()),
+		&SolskinClusterPolicy{},
+		0,
+		cache.Indexers{},
+	)
+	cluster.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { SetClusterPolicy(obj.(*SolskinClusterPolicy)) },
+		UpdateFunc: func(_, obj interface{}) { SetClusterPolicy(obj.(*SolskinClusterPolicy)) },
+		DeleteFunc: func(obj interface{}) {
+			if p, ok := untombstone(obj).(*SolskinClusterPolicy); ok {
+				DeleteClusterPolicy(p)
+			}
+		},
+	})
+
+	return []cache.SharedIndexInformer{namespaced, cluster}
+}
+
+// NewRESTClient creates a client for the solskin custom resources.
+func NewRESTClient(cfg *rest.Config) (*rest.RESTClient, error) {
+	scheme := runtime.NewScheme()
+	if err := AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+
+	config := *cfg
+	config.GroupVersion = &SchemeGroupVersion
+	config.APIPath = "/apis"
+	config.ContentType = runtime.ContentTypeJSON
+	config.NegotiatedSerializer = serializer.WithoutConversionCodecFactory{
+		CodecFactory: serializer.NewCodecFactory(scheme),
+	}
+	return rest.RESTClientFor(&config)
+}
+
+// Load lists the policy custom resources once, adding them to the policy
+// store, for commands that don't run the policy informers.
+func Load(client rest.Interface) error {
+	namespaced := &SolskinPolicyList{}
+	if err := client.Get().Resource("solskinpolicies").Do(context.TODO()).Into(namespaced); err != nil {
+		return err
+	}
+	for i := range namespaced.Items {
+		SetPolicy(&namespaced.Items[i])
+	}
+
+	cluster := &SolskinClusterPolicyList{}
+	if err := client.Get().Resource("solskinclusterpolicies").Do(context.TODO()).Into(cluster); err != nil {
+		return err
+	}
+	for i := range cluster.Items {
+		SetClusterPolicy(&cluster.Items[i])
+	}
+	return nil
+}
+
+// SetPolicy adds or updates the namespaced policy in the policy store.
+func SetPolicy(p *SolskinPolicy) {
+	policies.Lock()
+	defer policies.Unlock()
+	policies.namespaced[p.GetNamespace()+"/"+p.GetName()] = p
+}
+
+// DeletePolicy removes the namespaced policy from the policy store.
+func DeletePolicy(p *SolskinPolicy) {
+	policies.Lock()
+	defer policies.Unlock()
+	delete(policies.namespaced, p.GetNamespace()+"/"+p.GetName())
+}
+
+// SetClusterPolicy adds or updates the cluster policy in the policy store.
+func SetClusterPolicy(p *SolskinClusterPolicy) {
+	policies.Lock()
+	defer policies.Unlock()
+	policies.cluster[p.GetName()] = p
+}
+
+// DeleteClusterPolicy removes the cluster policy from the policy store.
+func DeleteClusterPolicy(p *SolskinClusterPolicy) {
+	policies.Lock()
+	defer policies.Unlock()
+	delete(policies.cluster, p.GetName())
+}
+
+// Find returns the spec of the policy applying to the given resource, or nil
+// if no policy applies. Policies in the resource's namespace take precedence
+// over cluster policies, and policies are otherwise considered in order of
+// their names.
+func Find(obj interface{}) *Spec {
+	m, ktype := common.GetObjectMeta(obj)
+
+	policies.RLock()
+	defer policies.RUnlock()
+
+	keys := []string{}
+	for key, p := range policies.namespaced {
+		if p.GetNamespace() == m.GetNamespace() {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		spec := policies.namespaced[key].Spec
+		if matches(spec, m, ktype) {
+			return &spec
+		}
+	}
+
+	keys = []string{}
+	for key := range policies.cluster {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		spec := policies.cluster[key].Spec
+		if matches(spec, m, ktype) {
+			return &spec
+		}
+	}
+	return nil
+}
+
+// IncludesCheck determines whether or not the named check should be
+// evaluated under the policy, a nil policy includes every check.
+func (s *Spec) IncludesCheck(check string) bool {
+	if s == nil || len(s.Checks) == 0 {
+		return true
+	}
+	for _, c := range s.Checks {
+		if c == check {
+			return true
+		}
+	}
+	return false
+}
+
+// ListsCheck determines whether or not the policy explicitly lists the named
+// check.
+func (s *Spec) ListsCheck(check string) bool {
+	return s != nil && len(s.Checks) > 0 && s.IncludesCheck(check)
+}
+
+// IncludeFunc returns a function determining whether or not a check should be
+// evaluated against the resource, honouring the checks enabled by the
+// configuration, the policy applying to the resource, and the checks the
+// resource is exempted from. Checks listed by the policy are evaluated even
+// when they aren't enabled by the configuration.
+func IncludeFunc(obj interface{}, cfg config.Config) func(string) bool {
+	skipped := common.GetSkippedChecks(obj, cfg)
+	p := Find(obj)
+	return func(check string) bool {
+		if !p.IncludesCheck(check) || common.IsCheckSkipped(check, skipped) {
+			return false
+		}
+		return p.ListsCheck(check) || common.IsCheckEnabled(check, cfg)
+	}
+}
+
+// Helper function to determine if the policy spec applies to a resource.
+func matches(spec Spec, m meta.ObjectMeta, ktype string) bool {
+	if len(spec.Kinds) > 0 {
+		found := false
+		for _, kind := range spec.Kinds {
+			found = found || kind == ktype
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if spec.Selector == nil {
+		return true
+	}
+
+	selector, err := meta.LabelSelectorAsSelector(spec.Selector)
+	if err != nil {
+		log.Printf("could not parse policy selector: %s", err)
+		return false
+	}
+	return selector.Matches(labels.Set(m.GetLabels()))
+}
+
+// Helper function to unwrap deleted objects the informer lost track of.
+func untombstone(obj interface{}) interface{} {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		return tombstone.Obj
+	}
+	return obj
+}
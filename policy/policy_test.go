@@ -0,0 +1,150 @@
+package policy
+
+import (
+	"github.com/micro/go-config"
+	"github.com/micro/go-config/source/env"
+	"github.com/stretchr/testify/assert"
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestFind(t *testing.T) {
+	namespaced := &SolskinPolicy{
+		ObjectMeta: meta.ObjectMeta{Name: "web", Namespace: "team"},
+		Spec: Spec{
+			Kinds: []string{"deployment"},
+			Selector: &meta.LabelSelector{
+				MatchLabels: map[string]string{"tier": "web"},
+			},
+			Action: "suppress",
+		},
+	}
+	cluster := &SolskinClusterPolicy{
+		ObjectMeta: meta.ObjectMeta{Name: "default"},
+		Spec:       Spec{Action: "log"},
+	}
+	SetPolicy(namespaced)
+	SetClusterPolicy(cluster)
+	defer DeletePolicy(namespaced)
+	defer DeleteClusterPolicy(cluster)
+
+	type Test struct {
+		Expected string
+		Resource interface{}
+	}
+
+	tests := []Test{
+		// Matching deployment in the policy's namespace.
+		Test{
+			Expected: "suppress",
+			Resource: &apps.Deployment{ObjectMeta: meta.ObjectMeta{
+				Namespace: "team",
+				Labels:    map[string]string{"tier": "web"},
+			}},
+		},
+
+		// Deployment not matching the selector falls back to the cluster policy.
+		Test{
+			Expected: "log",
+			Resource: &apps.Deployment{ObjectMeta: meta.ObjectMeta{
+				Namespace: "team",
+				Labels:    map[string]string{"tier": "db"},
+			}},
+		},
+
+		// Matching labels but not the kind.
+		Test{
+			Expected: "log",
+			Resource: &core.Pod{ObjectMeta: meta.ObjectMeta{
+				Namespace: "team",
+				Labels:    map[string]string{"tier": "web"},
+			}},
+		},
+
+		// Matching deployment in another namespace.
+		Test{
+			Expected: "log",
+			Resource: &apps.Deployment{ObjectMeta: meta.ObjectMeta{
+				Namespace: "other",
+				Labels:    map[string]string{"tier": "web"},
+			}},
+		},
+	}
+
+	for _, test := range tests {
+		spec := Find(test.Resource)
+		assert.NotNil(t, spec)
+		assert.Exactly(t, test.Expected, spec.Action)
+	}
+}
+
+func TestIncludesCheck(t *testing.T) {
+	var none *Spec
+	assert.True(t, none.IncludesCheck("liveness"))
+	assert.True(t, (&Spec{}).IncludesCheck("liveness"))
+	assert.True(t, (&Spec{Checks: []string{"liveness"}}).IncludesCheck("liveness"))
+	assert.False(t, (&Spec{Checks: []string{"readiness"}}).IncludesCheck("liveness"))
+}
+
+func TestIncludeFunc(t *testing.T) {
+	pod := &core.Pod{ObjectMeta: meta.ObjectMeta{Name: "app", Namespace: "team"}}
+
+	// Optional checks are only evaluated when enabled.
+	include := IncludeFunc(pod, config.NewConfig())
+	assert.True(t, include("liveness"))
+	assert.False(t, include("probe-delay"))
+
+	os.Setenv("SOLSKIN_CHECKS_PROBE_DELAY_ENABLED", "true")
+	os.Setenv("SOLSKIN_CHECKS_LIVENESS_ENABLED", "false")
+	defer os.Unsetenv("SOLSKIN_CHECKS_PROBE_DELAY_ENABLED")
+	defer os.Unsetenv("SOLSKIN_CHECKS_LIVENESS_ENABLED")
+	cfg := config.NewConfig()
+	cfg.Load(env.NewSource(env.WithStrippedPrefix("SOLSKIN")))
+	include = IncludeFunc(pod, cfg)
+	assert.False(t, include("liveness"))
+	assert.True(t, include("probe-delay"))
+
+	// Or when listed by the policy applying to the resource.
+	p := &SolskinPolicy{
+		ObjectMeta: meta.ObjectMeta{Name: "probes", Namespace: "team"},
+		Spec:       Spec{Checks: []string{"liveness", "probe-timeout"}},
+	}
+	SetPolicy(p)
+	defer DeletePolicy(p)
+	include = IncludeFunc(pod, config.NewConfig())
+	assert.True(t, include("liveness"))
+	assert.True(t, include("probe-timeout"))
+	assert.False(t, include("probe-delay"))
+	assert.False(t, include("readiness"))
+}
+
+func TestLoad(t *testing.T) {
+	lists := map[string]string{
+		"/apis/solskin.io/v1alpha1/solskinpolicies":        `{"items": [{"metadata": {"name": "probes", "namespace": "team"}, "spec": {"checks": ["liveness"]}}]}`,
+		"/apis/solskin.io/v1alpha1/solskinclusterpolicies": `{"items": [{"metadata": {"name": "default"}, "spec": {"action": "log"}}]}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(lists[r.URL.Path]))
+	}))
+	defer server.Close()
+
+	client, err := NewRESTClient(&rest.Config{Host: server.URL})
+	assert.Nil(t, err)
+	assert.Nil(t, Load(client))
+	defer DeletePolicy(&SolskinPolicy{ObjectMeta: meta.ObjectMeta{Name: "probes", Namespace: "team"}})
+	defer DeleteClusterPolicy(&SolskinClusterPolicy{ObjectMeta: meta.ObjectMeta{Name: "default"}})
+
+	// The namespaced policy applies within its namespace, the cluster policy
+	// everywhere else.
+	team := &core.Pod{ObjectMeta: meta.ObjectMeta{Name: "app", Namespace: "team"}}
+	other := &core.Pod{ObjectMeta: meta.ObjectMeta{Name: "app", Namespace: "other"}}
+	assert.Exactly(t, []string{"liveness"}, Find(team).Checks)
+	assert.Exactly(t, "log", Find(other).Action)
+}
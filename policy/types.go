@@ -0,0 +1,129 @@
+package policy
+
+import (
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// GroupName is the API group of the solskin custom resources.
+const GroupName = "solskin.io"
+
+// SchemeGroupVersion is the group version of the solskin custom resources.
+var SchemeGroupVersion = schema.GroupVersion{Group: GroupName, Version: "v1alpha1"}
+
+// Spec describes which resources a policy applies to and how they are
+// checked and suppressed.
+type Spec struct {
+	// Checks to evaluate, including optional ones, all checks enabled by the
+	// configuration are evaluated when empty.
+	Checks []string `json:"checks,omitempty"`
+
+	// Kinds of resources (e.g. "deployment") the policy applies to, all kinds
+	// when empty.
+	Kinds []string `json:"kinds,omitempty"`
+
+	// Selector for the labels of the resources the policy applies to, all
+	// resources when empty.
+	Selector *meta.LabelSelector `json:"selector,omitempty"`
+
+	// Action the suppressor takes, one of none, log, or suppress.
+	Action string `json:"action,omitempty"`
+
+	// Grace period before suppression, format is dictated by
+	// time.ParseDuration.
+	Grace string `json:"grace,omitempty"`
+}
+
+// SolskinPolicy is a policy applying to the resources of its namespace.
+type SolskinPolicy struct {
+	meta.TypeMeta   `json:",inline"`
+	meta.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec Spec `json:"spec"`
+}
+
+// SolskinPolicyList is a list of SolskinPolicy resources.
+type SolskinPolicyList struct {
+	meta.TypeMeta `json:",inline"`
+	meta.ListMeta `json:"metadata,omitempty"`
+
+	Items []SolskinPolicy `json:"items"`
+}
+
+// SolskinClusterPolicy is a policy applying to the resources of all
+// namespaces.
+type SolskinClusterPolicy struct {
+	meta.TypeMeta   `json:",inline"`
+	meta.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec Spec `json:"spec"`
+}
+
+// SolskinClusterPolicyList is a list of SolskinClusterPolicy resources.
+type SolskinClusterPolicyList struct {
+	meta.TypeMeta `json:",inline"`
+	meta.ListMeta `json:"metadata,omitempty"`
+
+	Items []SolskinClusterPolicy `json:"items"`
+}
+
+// AddToScheme registers the solskin custom resources with the scheme.
+func AddToScheme(scheme *runtime.Scheme) error {
+	scheme.AddKnownTypes(
+		SchemeGroupVersion,
+		&SolskinPolicy{},
+		&SolskinPolicyList{},
+		&SolskinClusterPolicy{},
+		&SolskinClusterPolicyList{},
+	)
+	meta.AddToGroupVersion(scheme, SchemeGroupVersion)
+	return nil
+}
+
+// DeepCopy returns a deep copy of the spec.
+func (in Spec) DeepCopy() Spec {
+	out := in
+	out.Checks = append([]string(nil), in.Checks...)
+	out.Kinds = append([]string(nil), in.Kinds...)
+	if in.Selector != nil {
+		out.Selector = in.Selector.DeepCopy()
+	}
+	return out
+}
+
+// DeepCopyObject returns a deep copy of the policy.
+func (in *SolskinPolicy) DeepCopyObject() runtime.Object {
+	out := *in
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec.DeepCopy()
+	return &out
+}
+
+// DeepCopyObject returns a deep copy of the policy list.
+func (in *SolskinPolicyList) DeepCopyObject() runtime.Object {
+	out := *in
+	out.Items = make([]SolskinPolicy, len(in.Items))
+	for i := range in.Items {
+		out.Items[i] = *in.Items[i].DeepCopyObject().(*SolskinPolicy)
+	}
+	return &out
+}
+
+// DeepCopyObject returns a deep copy of the cluster policy.
+func (in *SolskinClusterPolicy) DeepCopyObject() runtime.Object {
+	out := *in
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec.DeepCopy()
+	return &out
+}
+
+// DeepCopyObject returns a deep copy of the cluster policy list.
+func (in *SolskinClusterPolicyList) DeepCopyObject() runtime.Object {
+	out := *in
+	out.Items = make([]SolskinClusterPolicy, len(in.Items))
+	for i := range in.Items {
+		out.Items[i] = *in.Items[i].DeepCopyObject().(*SolskinClusterPolicy)
+	}
+	return &out
+}
@@ -0,0 +1,107 @@
+package queue
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/util/workqueue"
+)
+
+var depthMetric = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Help: "Number of kubernetes resources waiting to be processed, by service.",
+		Name: "solskin_queue_depth",
+	},
+	[]string{"service"},
+)
+
+var addsMetric = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Help: "Counter of kubernetes resources queued to be processed, by service.",
+		Name: "solskin_queue_adds",
+	},
+	[]string{"service"},
+)
+
+var retriesMetric = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Help: "Counter of retried kubernetes resource events, by service.",
+		Name: "solskin_queue_retries",
+	},
+	[]string{"service"},
+)
+
+var waitMetric = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Help: "Time a kubernetes resource waits in the queue before being processed, by service.",
+		Name: "solskin_queue_wait_seconds",
+	},
+	[]string{"service"},
+)
+
+var latencyMetric = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Help: "Time taken to process a kubernetes resource event, by service.",
+		Name: "solskin_queue_processing_seconds",
+	},
+	[]string{"service"},
+)
+
+var unfinishedMetric = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Help: "Seconds spent processing kubernetes resources that are still being processed, by service.",
+		Name: "solskin_queue_unfinished_seconds",
+	},
+	[]string{"service"},
+)
+
+var longestRunningMetric = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Help: "Seconds spent processing the longest running kubernetes resource, by service.",
+		Name: "solskin_queue_longest_running_seconds",
+	},
+	[]string{"service"},
+)
+
+// RegisterMetrics registers the prometheus metrics of the queues, which are
+// only recorded for queues created afterwards.
+func RegisterMetrics() {
+	prometheus.MustRegister(depthMetric)
+	prometheus.MustRegister(addsMetric)
+	prometheus.MustRegister(retriesMetric)
+	prometheus.MustRegister(waitMetric)
+	prometheus.MustRegister(latencyMetric)
+	prometheus.MustRegister(unfinishedMetric)
+	prometheus.MustRegister(longestRunningMetric)
+	workqueue.SetProvider(metricsProvider{})
+}
+
+// Provider of the metrics of the underlying work queues, labelled by the name
+// of the queue, which is the service it belongs to.
+type metricsProvider struct{}
+
+func (metricsProvider) NewDepthMetric(name string) workqueue.GaugeMetric {
+	return depthMetric.WithLabelValues(name)
+}
+
+func (metricsProvider) NewAddsMetric(name string) workqueue.CounterMetric {
+	return addsMetric.WithLabelValues(name)
+}
+
+func (metricsProvider) NewLatencyMetric(name string) workqueue.HistogramMetric {
+	return waitMetric.WithLabelValues(name)
+}
+
+func (metricsProvider) NewWorkDurationMetric(name string) workqueue.HistogramMetric {
+	return latencyMetric.WithLabelValues(name)
+}
+
+func (metricsProvider) NewUnfinishedWorkSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return unfinishedMetric.WithLabelValues(name)
+}
+
+func (metricsProvider) NewLongestRunningProcessorSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return longestRunningMetric.WithLabelValues(name)
+}
+
+func (metricsProvider) NewRetriesMetric(name string) workqueue.CounterMetric {
+	return retriesMetric.WithLabelValues(name)
+}
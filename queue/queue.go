@@ -0,0 +1,188 @@
+package queue
+
+import (
+	"github.com/ccpgames/kube-solskin-controller/common"
+	"golang.org/x/time/rate"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"log"
+	"sync"
+	"time"
+)
+
+// Handlers process the changes and deletions of kubernetes resources, an
+// error returned by a handler has the event retried with backoff.
+type Handlers struct {
+	OnChange func(obj interface{}) error
+	OnDelete func(obj interface{}) error
+}
+
+// Queue decouples the informers from the handlers of a service. Events are
+// keyed by resource in a work queue, so that only the latest state of a
+// resource is processed, a resource is never processed by two workers at once,
+// and failed events are retried as the rate limiter allows.
+type Queue struct {
+	Name       string
+	Handlers   []Handlers
+	MaxRetries int
+
+	queue  workqueue.RateLimitingInterface
+	lock   sync.Mutex
+	events map[string]*event
+}
+
+// Latest known state of a resource.
+type event struct {
+	obj     interface{}
+	deleted bool
+}
+
+// New creates a queue for the handlers of the named service.
+func New(name string, handlers []Handlers, maxRetries int, limiter workqueue.RateLimiter) *Queue {
+	return &Queue{
+		Name:       name,
+		Handlers:   handlers,
+		MaxRetries: maxRetries,
+		queue:      workqueue.NewNamedRateLimitingQueue(limiter, name),
+		events:     map[string]*event{},
+	}
+}
+
+// NewRateLimiter creates a rate limiter retrying every resource with
+// exponential backoff, while capping the overall rate of retries so that many
+// resources failing at once don't flood the API server.
+func NewRateLimiter(baseDelay, maxDelay time.Duration, qps float64, burst int) workqueue.RateLimiter {
+	return workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(baseDelay, maxDelay),
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(qps), burst)},
+	)
+}
+
+// EventHandlers returns the informer event handlers feeding the queue.
+func (q *Queue) EventHandlers() cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { q.Add(obj, false) },
+		UpdateFunc: func(_, obj interface{}) { q.Add(obj, false) },
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			q.Add(obj, true)
+		},
+	}
+}
+
+// Add queues the latest state of the resource to be processed, replacing any
+// state of the resource still waiting to be processed.
+func (q *Queue) Add(obj interface{}, deleted bool) {
+	key, err := Key(obj)
+	if err != nil {
+		log.Printf("%s: could not queue resource: %s", q.Name, err)
+		return
+	}
+
+	q.lock.Lock()
+	q.events[key] = &event{obj: obj, deleted: deleted}
+	q.lock.Unlock()
+
+	q.queue.Forget(key)
+	q.queue.Add(key)
+}
+
+// Start runs the given number of workers processing the queue until the
+// stopper is closed.
+func (q *Queue) Start(workers int, stopper <-chan struct{}) {
+	for i := 0; i < workers; i++ {
+		go func() {
+			for q.processNext() {
+			}
+		}()
+	}
+
+	go func() {
+		<-stopper
+		q.queue.ShutDown()
+	}()
+}
+
+// Len returns the number of resources waiting to be processed.
+func (q *Queue) Len() int {
+	return q.queue.Len()
+}
+
+// Key returns the key of a resource in the queue, its namespace and name
+// prefixed by its type.
+func Key(obj interface{}) (string, error) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return "", err
+	}
+	_, ktype := common.GetObjectMeta(obj)
+	return ktype + ":" + key, nil
+}
+
+// Helper function to wait for the next resource and process it, returning
+// false once the queue is shut down.
+func (q *Queue) processNext() bool {
+	item, shutdown := q.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer q.queue.Done(item)
+
+	key := item.(string)
+	q.lock.Lock()
+	e := q.events[key]
+	q.lock.Unlock()
+	if e == nil {
+		q.queue.Forget(key)
+		return true
+	}
+
+	err := q.process(e)
+
+	// Keep the state around for retries, unless a newer state of the resource
+	// arrived while processing, which the work queue has queued again already.
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.events[key] != e {
+		return true
+	}
+
+	if err == nil {
+		delete(q.events, key)
+		q.queue.Forget(key)
+		return true
+	}
+
+	failures := q.queue.NumRequeues(key)
+	if failures >= q.MaxRetries {
+		log.Printf("[%s] %s: giving up after %d retries: %s", key, q.Name, failures, err)
+		delete(q.events, key)
+		q.queue.Forget(key)
+		return true
+	}
+
+	log.Printf("[%s] %s: retrying: %s", key, q.Name, err)
+	q.queue.AddRateLimited(key)
+	return true
+}
+
+// Helper function to run every handler against the resource, returning the
+// first error encountered.
+func (q *Queue) process(e *event) error {
+	var result error
+	for _, h := range q.Handlers {
+		handler := h.OnChange
+		if e.deleted {
+			handler = h.OnDelete
+		}
+		if handler == nil {
+			continue
+		}
+		if err := handler(e.obj); err != nil && result == nil {
+			result = err
+		}
+	}
+	return result
+}
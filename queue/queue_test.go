@@ -0,0 +1,106 @@
+package queue
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"sync"
+	"testing"
+	"time"
+)
+
+func pod(name string, version string) *core.Pod {
+	return &core.Pod{ObjectMeta: meta.ObjectMeta{
+		Name:            name,
+		Namespace:       "default",
+		ResourceVersion: version,
+	}}
+}
+
+func TestKey(t *testing.T) {
+	key, err := Key(pod("app", "1"))
+	assert.NoError(t, err)
+	assert.Exactly(t, "pod:default/app", key)
+}
+
+func TestQueue(t *testing.T) {
+	var lock sync.Mutex
+	changed := map[string][]string{}
+	deleted := []string{}
+	attempts := 0
+	done := make(chan struct{}, 10)
+
+	q := New("test", []Handlers{
+		Handlers{
+			OnChange: func(obj interface{}) error {
+				lock.Lock()
+				defer lock.Unlock()
+				defer func() { done <- struct{}{} }()
+
+				p := obj.(*core.Pod)
+				if p.Name == "failing" {
+					attempts++
+					if attempts < 3 {
+						return fmt.Errorf("attempt %d failed", attempts)
+					}
+				}
+				changed[p.Name] = append(changed[p.Name], p.ResourceVersion)
+				return nil
+			},
+			OnDelete: func(obj interface{}) error {
+				lock.Lock()
+				defer lock.Unlock()
+				defer func() { done <- struct{}{} }()
+
+				deleted = append(deleted, obj.(*core.Pod).Name)
+				return nil
+			},
+		},
+	}, 5, NewRateLimiter(time.Millisecond, 10*time.Millisecond, 100, 10))
+
+	// Only the latest state of a queued resource is processed.
+	handlers := q.EventHandlers()
+	handlers.OnAdd(pod("app", "1"))
+	handlers.OnUpdate(pod("app", "1"), pod("app", "2"))
+	handlers.OnAdd(pod("failing", "1"))
+	handlers.OnDelete(cache.DeletedFinalStateUnknown{Key: "default/gone", Obj: pod("gone", "1")})
+	assert.Exactly(t, 3, q.Len())
+
+	stopper := make(chan struct{})
+	defer close(stopper)
+	q.Start(2, stopper)
+
+	// Failing resources are retried until they succeed.
+	for i := 0; i < 5; i++ {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for the queue")
+		}
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Exactly(t, []string{"2"}, changed["app"])
+	assert.Exactly(t, []string{"1"}, changed["failing"])
+	assert.Exactly(t, []string{"gone"}, deleted)
+	assert.Exactly(t, 3, attempts)
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := NewRateLimiter(time.Second, 5*time.Second, 100, 10)
+	assert.Exactly(t, time.Second, limiter.When("a"))
+	assert.Exactly(t, 2*time.Second, limiter.When("a"))
+	for i := 0; i < 5; i++ {
+		limiter.When("a")
+	}
+	assert.Exactly(t, 5*time.Second, limiter.When("a"))
+
+	// Once the burst is used up, retries wait for the bucket rather than their
+	// backoff.
+	limiter = NewRateLimiter(time.Second, 5*time.Second, 1.0/3600, 1)
+	assert.Exactly(t, time.Second, limiter.When("a"))
+	assert.True(t, limiter.When("b") > 59*time.Minute)
+}
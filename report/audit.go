@@ -0,0 +1,89 @@
+package report
+
+import (
+	"context"
+	"github.com/ccpgames/kube-solskin-controller/common"
+	"github.com/ccpgames/kube-solskin-controller/policy"
+	"github.com/micro/go-config"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// Audit lists every eligible resource in the namespace (or all namespaces when
+// empty) once, and reports how they fare against the checks. Pods managed by a
+// controller are reported through their controller. Policy custom resources
+// are read through the policy client when given.
+func Audit(client kubernetes.Interface, policies rest.Interface, cfg config.Config, namespace string) (Report, error) {
+	report := Report{Resources: []Resource{}}
+	opts := meta.ListOptions{}
+
+	// Namespace labels decide which namespaces are eligible.
+	namespaces, err := client.CoreV1().Namespaces().List(context.TODO(), opts)
+	if err != nil {
+		return report, err
+	}
+	for i := range namespaces.Items {
+		common.SetNamespace(&namespaces.Items[i])
+	}
+
+	// Policies decide which checks apply to the resources.
+	if policies != nil {
+		if err := policy.Load(policies); err != nil {
+			return report, err
+		}
+	}
+
+	objects := []interface{}{}
+	pods, err := client.CoreV1().Pods(namespace).List(context.TODO(), opts)
+	if err != nil {
+		return report, err
+	}
+	for i := range pods.Items {
+		if meta.GetControllerOf(&pods.Items[i]) == nil {
+			objects = append(objects, &pods.Items[i])
+		}
+	}
+
+	deployments, err := client.AppsV1().Deployments(namespace).List(context.TODO(), opts)
+	if err != nil {
+		return report, err
+	}
+	for i := range deployments.Items {
+		objects = append(objects, &deployments.Items[i])
+	}
+
+	daemonsets, err := client.AppsV1().DaemonSets(namespace).List(context.TODO(), opts)
+	if err != nil {
+		return report, err
+	}
+	for i := range daemonsets.Items {
+		objects = append(objects, &daemonsets.Items[i])
+	}
+
+	statefulsets, err := client.AppsV1().StatefulSets(namespace).List(context.TODO(), opts)
+	if err != nil {
+		return report, err
+	}
+	for i := range statefulsets.Items {
+		objects = append(objects, &statefulsets.Items[i])
+	}
+
+	jobs, err := client.BatchV1().Jobs(namespace).List(context.TODO(), opts)
+	if err != nil {
+		return report, err
+	}
+	for i := range jobs.Items {
+		objects = append(objects, &jobs.Items[i])
+	}
+
+	for _, obj := range objects {
+		m, _ := common.GetObjectMeta(obj)
+		if common.IsExempt(obj, cfg) || !common.IsEligibleNamespace(m.Namespace, cfg) {
+			continue
+		}
+		report.Add(obj, cfg)
+	}
+	report.Sort()
+	return report, nil
+}
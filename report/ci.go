@@ -0,0 +1,237 @@
+package report
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/ccpgames/kube-solskin-controller/common"
+	"io"
+)
+
+// Name and location of the tool, as reported in SARIF logs.
+const (
+	toolName = "kube-solskin-controller"
+	toolURI  = "https://github.com/ccpgames/kube-solskin-controller"
+)
+
+// Subset of the SARIF 2.1.0 format we produce.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Kind      string          `json:"kind"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation *sarifPhysicalLocation `json:"physicalLocation,omitempty"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+type sarifLogicalLocation struct {
+	Name               string `json:"name"`
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+// Helper function to render the report as a SARIF 2.1.0 log, with a rule per
+// check and a result per check of every resource.
+func renderSARIF(w io.Writer, r Report) error {
+	rules := []sarifRule{}
+	indices := map[string]int{}
+	for _, check := range common.GetChecks() {
+		indices[check.Name()] = len(rules)
+		rules = append(rules, sarifRule{
+			ID:               check.Name(),
+			ShortDescription: sarifMessage{Text: check.Description()},
+		})
+	}
+
+	results := []sarifResult{}
+	for _, resource := range r.Resources {
+		location := sarifLocation{
+			LogicalLocations: []sarifLogicalLocation{
+				sarifLogicalLocation{
+					Name:               resource.Name,
+					FullyQualifiedName: qualifiedName(resource),
+					Kind:               "resource",
+				},
+			},
+		}
+		if resource.File != "" {
+			location.PhysicalLocation = &sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: resource.File},
+				Region:           sarifRegion{StartLine: resource.Line},
+			}
+		}
+
+		for _, result := range resource.Results {
+			sr := sarifResult{
+				RuleID:    result.Check,
+				RuleIndex: indices[result.Check],
+				Kind:      "pass",
+				Level:     "none",
+				Message:   sarifMessage{Text: fmt.Sprintf("%s meets %s requirements", qualifiedName(resource), result.Check)},
+				Locations: []sarifLocation{location},
+			}
+			if !result.Passed {
+				sr.Kind = "fail"
+				sr.Level = "error"
+				sr.Message.Text = fmt.Sprintf("%s does not meet %s requirements: %s", qualifiedName(resource), result.Check, result.Reason)
+			}
+			results = append(results, sr)
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{
+			sarifRun{
+				Tool: sarifTool{
+					Driver: sarifDriver{Name: toolName, InformationURI: toolURI, Rules: rules},
+				},
+				Results: results,
+			},
+		},
+	})
+}
+
+// Subset of the JUnit XML format we produce.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	File      string        `xml:"file,attr,omitempty"`
+	Line      int           `xml:"line,attr,omitempty"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// Helper function to render the report as JUnit XML, with a test suite per
+// check and a test case per resource evaluated against it.
+func renderJUnit(w io.Writer, r Report) error {
+	suites := []junitTestSuite{}
+	indices := map[string]int{}
+	for _, check := range common.GetChecks() {
+		indices[check.Name()] = len(suites)
+		suites = append(suites, junitTestSuite{Name: check.Name(), TestCases: []junitTestCase{}})
+	}
+
+	root := junitTestSuites{Name: toolName}
+	for _, resource := range r.Resources {
+		for _, result := range resource.Results {
+			i, ok := indices[result.Check]
+			if !ok {
+				indices[result.Check] = len(suites)
+				i = len(suites)
+				suites = append(suites, junitTestSuite{Name: result.Check, TestCases: []junitTestCase{}})
+			}
+
+			testCase := junitTestCase{
+				Name:      qualifiedName(resource),
+				ClassName: result.Check,
+				File:      resource.File,
+				Line:      resource.Line,
+			}
+			if !result.Passed {
+				testCase.Failure = &junitFailure{
+					Message: result.Reason,
+					Type:    result.Check,
+					Text:    fmt.Sprintf("%s does not meet %s requirements: %s", qualifiedName(resource), result.Check, result.Reason),
+				}
+				suites[i].Failures++
+				root.Failures++
+			}
+			suites[i].Tests++
+			suites[i].TestCases = append(suites[i].TestCases, testCase)
+			root.Tests++
+		}
+	}
+	root.Suites = suites
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(root); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// Helper function to build the fully qualified name of a resource, leaving out
+// the namespace when it isn't set.
+func qualifiedName(resource Resource) string {
+	if resource.Namespace == "" {
+		return fmt.Sprintf("%s/%s", resource.Kind, resource.Name)
+	}
+	return fmt.Sprintf("%s/%s/%s", resource.Namespace, resource.Kind, resource.Name)
+}
@@ -0,0 +1,195 @@
+package report
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/ccpgames/kube-solskin-controller/common"
+	"github.com/micro/go-config"
+	"io"
+	"io/ioutil"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Stdin is the path used to lint manifests read from standard input.
+const Stdin = "-"
+
+// Extensions of the manifest files linted when walking directories.
+var manifestExtensions = map[string]bool{
+	".yaml": true,
+	".yml":  true,
+	".json": true,
+}
+
+// Document is a single kubernetes manifest, along with where it came from.
+type Document struct {
+	File string
+	Line int
+	Data []byte
+}
+
+// Lint reports how the kubernetes manifests found in the given files and
+// directories fare against the checks, without needing a cluster. Manifests
+// that cannot be decoded are returned as errors alongside the report.
+func Lint(paths []string, stdin io.Reader, cfg config.Config) (Report, []error) {
+	report := Report{Resources: []Resource{}}
+	errors := []error{}
+
+	documents := []Document{}
+	for _, path := range paths {
+		docs, err := readPath(path, stdin)
+		if err != nil {
+			errors = append(errors, err)
+			continue
+		}
+		documents = append(documents, docs...)
+	}
+
+	for _, doc := range documents {
+		objects, err := decodeDocument(doc.Data)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("%s:%d: %s", doc.File, doc.Line, err))
+			continue
+		}
+
+		for _, obj := range objects {
+			if common.IsExempt(obj, cfg) {
+				continue
+			}
+			resource := Evaluate(obj, cfg)
+			resource.File = doc.File
+			resource.Line = doc.Line
+			report.Resources = append(report.Resources, resource)
+		}
+	}
+	return report, errors
+}
+
+// Helper function to read the documents of a file, of every manifest file in a
+// directory, or of standard input.
+func readPath(path string, stdin io.Reader) ([]Document, error) {
+	if path == Stdin {
+		return readDocuments("<stdin>", stdin)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return readFile(path)
+	}
+
+	documents := []Document{}
+	err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !manifestExtensions[strings.ToLower(filepath.Ext(file))] {
+			return nil
+		}
+
+		docs, err := readFile(file)
+		if err != nil {
+			return err
+		}
+		documents = append(documents, docs...)
+		return nil
+	})
+	return documents, err
+}
+
+// Helper function to read the documents of a file.
+func readFile(path string) ([]Document, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readDocuments(path, f)
+}
+
+// Helper function to split a multi-document YAML stream into its documents,
+// recording the line each document starts on. Empty documents are skipped.
+func readDocuments(name string, r io.Reader) ([]Document, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	documents := []Document{}
+	var current bytes.Buffer
+	start := 0
+	flush := func() {
+		if start > 0 {
+			documents = append(documents, Document{File: name, Line: start, Data: append([]byte{}, current.Bytes()...)})
+		}
+		current.Reset()
+		start = 0
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), len(data)+1)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if strings.HasPrefix(text, "---") && strings.TrimSpace(strings.TrimPrefix(text, "---")) == "" {
+			flush()
+			continue
+		}
+
+		// Documents start at their first line of content.
+		trimmed := strings.TrimSpace(text)
+		if start == 0 && trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			start = line
+		}
+		current.WriteString(text)
+		current.WriteString("\n")
+	}
+	flush()
+	return documents, scanner.Err()
+}
+
+// Helper function to decode a YAML or JSON document into the typed objects it
+// holds, expanding lists. Kinds of resources the checks don't apply to are
+// skipped.
+func decodeDocument(data []byte) ([]interface{}, error) {
+	data, err := yaml.ToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	header := struct {
+		Kind  string            `json:"kind"`
+		Items []json.RawMessage `json:"items"`
+	}{}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, err
+	}
+	if header.Kind == "" {
+		return nil, fmt.Errorf("document has no kind")
+	}
+
+	if strings.HasSuffix(header.Kind, "List") {
+		objects := []interface{}{}
+		for _, item := range header.Items {
+			decoded, err := decodeDocument(item)
+			if err != nil {
+				return nil, err
+			}
+			objects = append(objects, decoded...)
+		}
+		return objects, nil
+	}
+
+	obj, err := common.DecodeObject(header.Kind, data)
+	if err != nil || obj == nil {
+		return nil, err
+	}
+	return []interface{}{obj}, nil
+}
@@ -0,0 +1,168 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Renderer writes a report in a specific format.
+type Renderer func(w io.Writer, r Report) error
+
+// Renderers of every supported format, by name.
+var renderers = map[string]Renderer{
+	"table":    renderTable,
+	"json":     renderJSON,
+	"csv":      renderCSV,
+	"markdown": renderMarkdown,
+	"sarif":    renderSARIF,
+	"junit":    renderJUnit,
+}
+
+// Formats returns the names of every supported format.
+func Formats() []string {
+	formats := []string{}
+	for format := range renderers {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// Render writes the report in the given format.
+func Render(w io.Writer, r Report, format string) error {
+	renderer, ok := renderers[format]
+	if !ok {
+		return fmt.Errorf("unknown format [%s], available formats: %s", format, strings.Join(Formats(), ", "))
+	}
+	r.Sort()
+	return renderer(w, r)
+}
+
+// Helper function to render the report as a human readable table per
+// namespace.
+func renderTable(w io.Writer, r Report) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	sources := r.HasSources()
+	namespaces, grouped := r.Namespaces()
+	for i, namespace := range namespaces {
+		if i > 0 {
+			fmt.Fprintln(tw)
+		}
+		fmt.Fprintf(tw, "NAMESPACE: %s\n", displayNamespace(namespace))
+		fmt.Fprintln(tw, strings.Join(columns(sources, "SOURCE", "KIND", "NAME", "CHECK", "RESULT", "REASON"), "\t"))
+		for _, resource := range grouped[namespace] {
+			for _, result := range resource.Results {
+				row := columns(sources, resource.Source(), resource.Kind, resource.Name, result.Check, status(result), result.Reason)
+				fmt.Fprintln(tw, strings.Join(row, "\t"))
+			}
+		}
+	}
+
+	if len(namespaces) > 0 {
+		fmt.Fprintln(tw)
+	}
+	fmt.Fprintf(tw, "%d resource(s), %d violation(s)\n", len(r.Resources), r.Violations())
+	return tw.Flush()
+}
+
+// Helper function to render the report as JSON.
+func renderJSON(w io.Writer, r Report) error {
+	resources := r.Resources
+	if resources == nil {
+		resources = []Resource{}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(struct {
+		Resources  []Resource `json:"resources"`
+		Violations int        `json:"violations"`
+	}{resources, r.Violations()})
+}
+
+// Helper function to render the report as CSV, one row per check of every
+// resource.
+func renderCSV(w io.Writer, r Report) error {
+	writer := csv.NewWriter(w)
+	sources := r.HasSources()
+	writer.Write(columns(sources, "source", "namespace", "kind", "name", "check", "passed", "reason"))
+	for _, resource := range r.Resources {
+		for _, result := range resource.Results {
+			writer.Write(columns(
+				sources,
+				resource.Source(),
+				resource.Namespace,
+				resource.Kind,
+				resource.Name,
+				result.Check,
+				strconv.FormatBool(result.Passed),
+				result.Reason,
+			))
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// Helper function to render the report as Markdown, with a table per
+// namespace.
+func renderMarkdown(w io.Writer, r Report) error {
+	fmt.Fprintln(w, "# Compliance Report")
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "%d resource(s), %d violation(s)\n", len(r.Resources), r.Violations())
+
+	sources := r.HasSources()
+	namespaces, grouped := r.Namespaces()
+	for _, namespace := range namespaces {
+		header := columns(sources, "Source", "Kind", "Name", "Check", "Result", "Reason")
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "## %s\n", displayNamespace(namespace))
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "| %s |\n", strings.Join(header, " | "))
+		fmt.Fprintf(w, "|%s\n", strings.Repeat("---|", len(header)))
+		for _, resource := range grouped[namespace] {
+			for _, result := range resource.Results {
+				row := columns(sources, resource.Source(), resource.Kind, resource.Name, result.Check, status(result), escapeMarkdown(result.Reason))
+				fmt.Fprintf(w, "| %s |\n", strings.Join(row, " | "))
+			}
+		}
+	}
+	return nil
+}
+
+// Helper function to build the columns of a row, where the first column is the
+// source of the resource and only included when the resources have sources.
+func columns(sources bool, source string, rest ...string) []string {
+	if sources {
+		return append([]string{source}, rest...)
+	}
+	return rest
+}
+
+// Helper function to display the namespace of resources, which manifests don't
+// necessarily set.
+func displayNamespace(namespace string) string {
+	if namespace == "" {
+		return "<none>"
+	}
+	return namespace
+}
+
+// Helper function to describe the status of a result.
+func status(result Result) string {
+	if result.Passed {
+		return "PASS"
+	}
+	return "FAIL"
+}
+
+// Helper function to escape text for use in a Markdown table cell.
+func escapeMarkdown(text string) string {
+	return strings.Replace(text, "|", "\\|", -1)
+}
@@ -0,0 +1,131 @@
+package report
+
+import (
+	"fmt"
+	"github.com/ccpgames/kube-solskin-controller/common"
+	"github.com/ccpgames/kube-solskin-controller/policy"
+	"github.com/micro/go-config"
+	"sort"
+)
+
+// Result is the outcome of a single check evaluated against a resource.
+type Result struct {
+	Check  string `json:"check"`
+	Passed bool   `json:"passed"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Resource holds the results of every check evaluated against a kubernetes
+// resource.
+type Resource struct {
+	Kind      string   `json:"kind"`
+	Name      string   `json:"name"`
+	Namespace string   `json:"namespace"`
+	File      string   `json:"file,omitempty"`
+	Line      int      `json:"line,omitempty"`
+	Results   []Result `json:"results"`
+}
+
+// Report is the compliance report of a set of kubernetes resources.
+type Report struct {
+	Resources []Resource `json:"resources"`
+}
+
+// Evaluate runs every check that applies to the resource against it.
+func Evaluate(obj interface{}, cfg config.Config) Resource {
+	m, ktype := common.GetObjectMeta(obj)
+	resource := Resource{
+		Kind:      ktype,
+		Name:      m.GetName(),
+		Namespace: m.GetNamespace(),
+		Results:   []Result{},
+	}
+
+	for _, evaluation := range common.EvaluateChecks(obj, cfg, policy.IncludeFunc(obj, cfg)) {
+		resource.Results = append(resource.Results, Result{
+			Check:  evaluation.Check.Name(),
+			Passed: evaluation.Result.Passed,
+			Reason: evaluation.Result.Reason,
+		})
+	}
+	return resource
+}
+
+// Add evaluates the resource and adds it to the report.
+func (r *Report) Add(obj interface{}, cfg config.Config) {
+	r.Resources = append(r.Resources, Evaluate(obj, cfg))
+}
+
+// Sort orders the resources of the report by namespace, kind, and name.
+func (r *Report) Sort() {
+	sort.SliceStable(r.Resources, func(i, j int) bool {
+		a, b := r.Resources[i], r.Resources[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+}
+
+// Violations returns the number of failed checks across all resources.
+func (r Report) Violations() int {
+	violations := 0
+	for _, resource := range r.Resources {
+		violations += resource.Violations()
+	}
+	return violations
+}
+
+// Violations returns the number of checks the resource fails.
+func (r Resource) Violations() int {
+	violations := 0
+	for _, result := range r.Results {
+		if !result.Passed {
+			violations++
+		}
+	}
+	return violations
+}
+
+// Source returns the file and line the resource was read from, if any.
+func (r Resource) Source() string {
+	if r.File == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", r.File, r.Line)
+}
+
+// HasSources determines whether or not the resources of the report were read
+// from files.
+func (r Report) HasSources() bool {
+	for _, resource := range r.Resources {
+		if resource.File != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Namespaces returns the resources of the report grouped by namespace, along
+// with the namespaces in order.
+func (r Report) Namespaces() ([]string, map[string][]Resource) {
+	namespaces := []string{}
+	grouped := map[string][]Resource{}
+	for _, resource := range r.Resources {
+		if _, ok := grouped[resource.Namespace]; !ok {
+			namespaces = append(namespaces, resource.Namespace)
+		}
+		grouped[resource.Namespace] = append(grouped[resource.Namespace], resource)
+	}
+	sort.Strings(namespaces)
+	return namespaces, grouped
+}
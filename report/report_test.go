@@ -0,0 +1,214 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"github.com/ccpgames/kube-solskin-controller/common"
+	"github.com/micro/go-config"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAudit(t *testing.T) {
+	controller := true
+	client := fake.NewSimpleClientset(
+		&core.Namespace{ObjectMeta: meta.ObjectMeta{Name: "default"}},
+		&core.Namespace{ObjectMeta: meta.ObjectMeta{Name: "kube-system"}},
+		&apps.Deployment{ObjectMeta: meta.ObjectMeta{Name: "app", Namespace: "default"}},
+		&core.Pod{ObjectMeta: meta.ObjectMeta{Name: "bare", Namespace: "default"}},
+		&core.Pod{ObjectMeta: meta.ObjectMeta{
+			Name:      "app-1234",
+			Namespace: "default",
+			OwnerReferences: []meta.OwnerReference{
+				meta.OwnerReference{Kind: "ReplicaSet", Name: "app", Controller: &controller},
+			},
+		}},
+		&core.Pod{ObjectMeta: meta.ObjectMeta{
+			Name:        "exempt",
+			Namespace:   "default",
+			Annotations: map[string]string{"solskin.io/exempt": "true"},
+		}},
+		&core.Pod{ObjectMeta: meta.ObjectMeta{Name: "system", Namespace: "kube-system"}},
+	)
+
+	r, err := Audit(client, nil, config.NewConfig(), "")
+	assert.Nil(t, err)
+	assert.Len(t, r.Resources, 2)
+	assert.Exactly(t, "deployment", r.Resources[0].Kind)
+	assert.Exactly(t, "pod", r.Resources[1].Kind)
+	assert.Exactly(t, "bare", r.Resources[1].Name)
+	assert.Exactly(t, 10, r.Violations())
+}
+
+func TestRender(t *testing.T) {
+	r := Report{Resources: []Resource{
+		Resource{
+			Kind:      "pod",
+			Name:      "app",
+			Namespace: "team-b",
+			Results: []Result{
+				Result{Check: "liveness", Passed: false, Reason: "container [app] has no liveness probe"},
+				Result{Check: "readiness", Passed: true},
+			},
+		},
+		Resource{
+			Kind:      "deployment",
+			Name:      "web",
+			Namespace: "team-a",
+			Results: []Result{
+				Result{Check: "limits", Passed: true},
+			},
+		},
+	}}
+
+	tests := map[string][]string{
+		"table": []string{
+			"NAMESPACE: team-a",
+			"NAMESPACE: team-b",
+			"container [app] has no liveness probe",
+			"2 resource(s), 1 violation(s)",
+		},
+		"csv": []string{
+			"namespace,kind,name,check,passed,reason",
+			"team-b,pod,app,liveness,false,container [app] has no liveness probe",
+		},
+		"markdown": []string{
+			"## team-a",
+			"| pod | app | liveness | FAIL | container [app] has no liveness probe |",
+		},
+	}
+
+	for format, expected := range tests {
+		var out bytes.Buffer
+		assert.Nil(t, Render(&out, r, format))
+		for _, line := range expected {
+			assert.Contains(t, out.String(), line, format)
+		}
+	}
+
+	// Namespaces are listed in order.
+	var out bytes.Buffer
+	assert.Nil(t, Render(&out, r, "table"))
+	assert.True(t, strings.Index(out.String(), "team-a") < strings.Index(out.String(), "team-b"))
+
+	out.Reset()
+	assert.Nil(t, Render(&out, r, "json"))
+	decoded := struct {
+		Resources  []Resource `json:"resources"`
+		Violations int        `json:"violations"`
+	}{}
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &decoded))
+	assert.Len(t, decoded.Resources, 2)
+	assert.Exactly(t, 1, decoded.Violations)
+
+	assert.Error(t, Render(&out, r, "unknown"))
+}
+
+func TestLint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solskin")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	manifest := `# deployment without any standards
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+---
+
+apiVersion: extensions/v1beta1
+kind: DaemonSet
+metadata:
+  name: agent
+  annotations:
+    solskin.io/exempt: "true"
+`
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "web.yaml"), []byte(manifest), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("not a manifest"), 0644))
+
+	stdin := strings.NewReader(`{"apiVersion": "v1", "kind": "List", "items": [{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "bare"}}]}`)
+	r, errs := Lint([]string{dir, Stdin}, stdin, config.NewConfig())
+	assert.Empty(t, errs)
+	assert.Len(t, r.Resources, 2)
+	r.Sort()
+
+	assert.Exactly(t, "deployment", r.Resources[0].Kind)
+	assert.Exactly(t, filepath.Join(dir, "web.yaml"), r.Resources[0].File)
+	assert.Exactly(t, 2, r.Resources[0].Line)
+	assert.Exactly(t, 5, r.Resources[0].Violations())
+
+	assert.Exactly(t, "pod", r.Resources[1].Kind)
+	assert.Exactly(t, "<stdin>:1", r.Resources[1].Source())
+
+	// Documents that can't be decoded are reported with their location.
+	_, errs = Lint([]string{Stdin}, strings.NewReader("kind: Pod\n---\nmetadata: {}\n"), config.NewConfig())
+	assert.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "<stdin>:3")
+}
+
+func TestRenderCI(t *testing.T) {
+	r := Report{Resources: []Resource{
+		Resource{
+			Kind:      "deployment",
+			Name:      "web",
+			Namespace: "team",
+			File:      "deploy/web.yaml",
+			Line:      3,
+			Results: []Result{
+				Result{Check: "liveness", Passed: false, Reason: "container [web] has no liveness probe"},
+				Result{Check: "readiness", Passed: true},
+			},
+		},
+	}}
+
+	var out bytes.Buffer
+	assert.Nil(t, Render(&out, r, "sarif"))
+	sarif := sarifLog{}
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &sarif))
+	assert.Exactly(t, "2.1.0", sarif.Version)
+	assert.Len(t, sarif.Runs[0].Tool.Driver.Rules, len(common.GetChecks()))
+	assert.Len(t, sarif.Runs[0].Results, 2)
+
+	failed := sarif.Runs[0].Results[0]
+	assert.Exactly(t, "liveness", failed.RuleID)
+	assert.Exactly(t, "liveness", sarif.Runs[0].Tool.Driver.Rules[failed.RuleIndex].ID)
+	assert.Exactly(t, "error", failed.Level)
+	assert.Exactly(t, "deploy/web.yaml", failed.Locations[0].PhysicalLocation.ArtifactLocation.URI)
+	assert.Exactly(t, 3, failed.Locations[0].PhysicalLocation.Region.StartLine)
+	assert.Exactly(t, "team/deployment/web", failed.Locations[0].LogicalLocations[0].FullyQualifiedName)
+	assert.Exactly(t, "pass", sarif.Runs[0].Results[1].Kind)
+
+	out.Reset()
+	assert.Nil(t, Render(&out, r, "junit"))
+	junit := junitTestSuites{}
+	assert.Nil(t, xml.Unmarshal(out.Bytes(), &junit))
+	assert.Exactly(t, 2, junit.Tests)
+	assert.Exactly(t, 1, junit.Failures)
+	for _, suite := range junit.Suites {
+		switch suite.Name {
+		case "liveness":
+			assert.Exactly(t, 1, suite.Failures)
+			assert.Exactly(t, "team/deployment/web", suite.TestCases[0].Name)
+			assert.Exactly(t, "container [web] has no liveness probe", suite.TestCases[0].Failure.Message)
+		case "readiness":
+			assert.Exactly(t, 1, suite.Tests)
+			assert.Nil(t, suite.TestCases[0].Failure)
+		default:
+			assert.Exactly(t, 0, suite.Tests)
+		}
+	}
+}
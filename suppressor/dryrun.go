@@ -0,0 +1,135 @@
+package suppressor
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ccpgames/kube-solskin-controller/common"
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"sync"
+	"time"
+)
+
+var wouldSuppressMetric = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Help: "Kubernetes resources that would be suppressed if the dry run action was suppress.",
+		Name: "solskin_would_suppress",
+	},
+	[]string{
+		"name",
+		"namespace",
+		"resource_type",
+		"target",
+		"action",
+	},
+)
+
+// Labels of the would suppress metric of every resource, so that they can be
+// removed once the resource would no longer be suppressed.
+var dryRuns = struct {
+	sync.Mutex
+	m map[string]prometheus.Labels
+}{m: map[string]prometheus.Labels{}}
+
+// Reference identifies a kubernetes resource in a decision.
+type Reference struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+// Decision is the record of how the suppressor would have suppressed a
+// resource, produced by the dry run action.
+type Decision struct {
+	Resource  Reference `json:"resource"`
+	Checks    []string  `json:"failed_checks"`
+	Target    Reference `json:"target"`
+	Action    string    `json:"action"`
+	Grace     string    `json:"grace,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Helper function to record how the resource would have been suppressed,
+// through the target resource, without suppressing anything.
+func (s Service) dryRun(obj interface{}, target interface{}, failures []string) error {
+	action, err := s.plan(target)
+	if err != nil {
+		return err
+	}
+
+	decision := Decision{
+		Resource:  reference(obj),
+		Checks:    failures,
+		Target:    reference(target),
+		Action:    action,
+		Timestamp: time.Now().UTC(),
+	}
+	if grace := s.gracePeriod(target); grace > 0 {
+		decision.Grace = grace.String()
+	}
+
+	data, err := json.Marshal(decision)
+	if err != nil {
+		return err
+	}
+	log.Printf("[%s] dry run: %s", common.GetFullLabel(obj), data)
+
+	labels := metricLabels(obj)
+	labels["target"] = common.GetFullLabel(target)
+	labels["action"] = action
+
+	key := common.GetFullLabel(obj)
+	dryRuns.Lock()
+	defer dryRuns.Unlock()
+	if previous, ok := dryRuns.m[key]; ok {
+		wouldSuppressMetric.Delete(previous)
+	}
+	dryRuns.m[key] = labels
+	wouldSuppressMetric.With(labels).Set(1)
+	return nil
+}
+
+// Helper function to forget about the dry run of a resource that would no
+// longer be suppressed.
+func clearDryRun(obj interface{}) {
+	key := common.GetFullLabel(obj)
+	dryRuns.Lock()
+	defer dryRuns.Unlock()
+	if labels, ok := dryRuns.m[key]; ok {
+		wouldSuppressMetric.Delete(labels)
+		delete(dryRuns.m, key)
+	}
+}
+
+// Helper function to describe how the resource would be suppressed, mirroring
+// what suppress does.
+func (s Service) plan(obj interface{}) (string, error) {
+	_, ktype := common.GetObjectMeta(obj)
+	switch ktype {
+	case "pod":
+		return "delete", nil
+	case "deployment", "replicaset", "statefulset":
+		return "scale to zero replicas", nil
+	case "daemonset":
+		if s.daemonSetAction() == DaemonSetActionPark {
+			return "park on a node selector matching no node", nil
+		}
+		return "delete", nil
+	case "job":
+		if s.jobAction() == JobActionSuspend {
+			return "suspend", nil
+		}
+		return "delete", nil
+	}
+	return "", fmt.Errorf("cannot suppress resource of type [%s]", ktype)
+}
+
+// Helper function to build the reference of a resource.
+func reference(obj interface{}) Reference {
+	m, ktype := common.GetObjectMeta(obj)
+	return Reference{
+		Kind:      ktype,
+		Name:      m.GetName(),
+		Namespace: m.GetNamespace(),
+	}
+}
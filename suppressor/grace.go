@@ -0,0 +1,125 @@
+package suppressor
+
+import (
+	"fmt"
+	"github.com/ccpgames/kube-solskin-controller/common"
+	"github.com/ccpgames/kube-solskin-controller/notifier"
+	"github.com/ccpgames/kube-solskin-controller/policy"
+	"github.com/prometheus/client_golang/prometheus"
+	core "k8s.io/api/core/v1"
+	"log"
+	"time"
+)
+
+// ScheduleAnnotation is the annotation used to record when a non-compliant
+// resource is scheduled to be suppressed.
+const ScheduleAnnotation = "solskin.io/suppression-scheduled"
+
+var pendingSuppressionsMetric = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Help: "Kubernetes resources scheduled for suppression, valued at the unix time the suppression is due.",
+		Name: "solskin_pending_suppressions",
+	},
+	[]string{
+		"name",
+		"namespace",
+		"resource_type",
+	},
+)
+
+// Helper function to retrieve the grace period of the resource, which a policy
+// can override, where zero means there is no grace period.
+func (s Service) gracePeriod(obj interface{}) time.Duration {
+	grace := s.Configuration.Get(s.GetSlug(), "grace").String("off")
+	if p := policy.Find(obj); p != nil && p.Grace != "" {
+		grace = p.Grace
+	}
+	if grace == "off" {
+		return 0
+	}
+
+	duration, err := time.ParseDuration(grace)
+	if err != nil {
+		log.Printf("could not parse grace duration, value given: [%s]", grace)
+		log.Println("defaulting to no grace period")
+		return 0
+	}
+	return duration
+}
+
+// Helper function to determine whether or not the grace period of a
+// non-compliant resource has run out, scheduling the suppression if it hasn't
+// been scheduled yet.
+func (s Service) graceExpired(obj interface{}, failures []string) bool {
+	grace := s.gracePeriod(obj)
+	if grace <= 0 {
+		return true
+	}
+
+	m, _ := common.GetObjectMeta(obj)
+	fqname := common.GetFullLabel(obj)
+	labels := metricLabels(obj)
+
+	// If the resource has already been scheduled, check the deadline.
+	if value, ok := m.GetAnnotations()[ScheduleAnnotation]; ok {
+		deadline, err := time.Parse(time.RFC3339, value)
+		if err == nil {
+			if time.Now().Before(deadline) {
+				pendingSuppressionsMetric.With(labels).Set(float64(deadline.Unix()))
+				return false
+			}
+
+			pendingSuppressionsMetric.Delete(labels)
+			return true
+		}
+		log.Printf("[%s] could not parse suppression schedule [%s], rescheduling", fqname, value)
+	}
+
+	// Otherwise schedule the suppression for the end of the grace period.
+	deadline := time.Now().Add(grace).UTC().Truncate(time.Second)
+	timestamp := deadline.Format(time.RFC3339)
+	err := common.PatchAnnotations(s.Client, obj, map[string]string{
+		ScheduleAnnotation: timestamp,
+	})
+	if err != nil {
+		log.Printf("[%s] could not schedule suppression: %s", fqname, err)
+		return false
+	}
+
+	log.Printf("[%s] scheduled for suppression at %s", fqname, timestamp)
+	pendingSuppressionsMetric.With(labels).Set(float64(deadline.Unix()))
+	message := fmt.Sprintf("Resource does not meet standards and will be suppressed at %s", timestamp)
+	s.recordEvent(obj, core.EventTypeWarning, "SuppressionScheduled", message)
+	notifier.Publish(notifier.NewNotification(obj, notifier.TypeScheduled, failures, message))
+	return false
+}
+
+// Helper function to cancel any scheduled suppression of a resource that now
+// meets standards.
+func (s Service) cancelSchedule(obj interface{}) {
+	m, _ := common.GetObjectMeta(obj)
+	if _, ok := m.GetAnnotations()[ScheduleAnnotation]; !ok {
+		return
+	}
+
+	fqname := common.GetFullLabel(obj)
+	pendingSuppressionsMetric.Delete(metricLabels(obj))
+	err := common.PatchAnnotations(s.Client, obj, map[string]string{
+		ScheduleAnnotation: "",
+	})
+	if err != nil {
+		log.Printf("[%s] could not cancel scheduled suppression: %s", fqname, err)
+		return
+	}
+	log.Printf("[%s] meets standards, scheduled suppression cancelled", fqname)
+}
+
+// Helper function to generate the metric labels of a resource.
+func metricLabels(obj interface{}) map[string]string {
+	m, ktype := common.GetObjectMeta(obj)
+	return map[string]string{
+		"name":          m.GetName(),
+		"namespace":     m.GetNamespace(),
+		"resource_type": ktype,
+	}
+}
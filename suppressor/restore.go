@@ -0,0 +1,154 @@
+package suppressor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ccpgames/kube-solskin-controller/common"
+	"github.com/ccpgames/kube-solskin-controller/notifier"
+	"github.com/prometheus/client_golang/prometheus"
+	apps "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"log"
+)
+
+// StateAnnotation is the annotation used to record the state of a resource
+// before it was suppressed.
+const StateAnnotation = "solskin.io/suppressed-state"
+
+// State is the pre-suppression state of a resource, everything needed to
+// restore the resource once it meets standards again.
+type State struct {
+	Replicas     *int32            `json:"replicas,omitempty"`
+	Suspend      *bool             `json:"suspend,omitempty"`
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+}
+
+var restoredResourcesMetric = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Help: "Counter of restored kubernetes resources.",
+		Name: "solskin_restored_resources",
+	},
+	[]string{
+		"name",
+		"namespace",
+		"resource_type",
+	},
+)
+
+// Helper function to determine if a resource has been suppressed by us.
+func isSuppressed(m meta.ObjectMeta) bool {
+	_, ok := m.GetAnnotations()[StateAnnotation]
+	return ok
+}
+
+// Helper function to record the pre-suppression state on the resource.
+func setState(m *meta.ObjectMeta, state State) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		log.Printf("could not encode suppression state: %s", err)
+		return
+	}
+
+	if m.Annotations == nil {
+		m.Annotations = map[string]string{}
+	}
+	m.Annotations[StateAnnotation] = string(data)
+}
+
+// Helper function to retrieve and clear the pre-suppression state of the
+// resource, along with any suppression schedule.
+func popState(m *meta.ObjectMeta) (State, error) {
+	state := State{}
+	data := m.GetAnnotations()[StateAnnotation]
+	delete(m.Annotations, StateAnnotation)
+	delete(m.Annotations, ScheduleAnnotation)
+	err := json.Unmarshal([]byte(data), &state)
+	return state, err
+}
+
+// Helper function to return the replica count of a resource, defaulting to
+// one as kubernetes does when unset.
+func replicasOf(replicas *int32) *int32 {
+	r := int32(1)
+	if replicas != nil {
+		r = *replicas
+	}
+	return &r
+}
+
+// Helper function to return whether or not a job is suspended, defaulting to
+// not suspended as kubernetes does when unset.
+func suspendOf(suspend *bool) *bool {
+	s := suspend != nil && *suspend
+	return &s
+}
+
+// Restores a previously suppressed resource to its pre-suppression state.
+func (s Service) restore(obj interface{}) error {
+	m, ktype := common.GetObjectMeta(obj)
+	fqname := common.GetFullLabel(obj)
+
+	var err error
+	var state State
+	switch ktype {
+	case "deployment":
+		dpl := obj.(*apps.Deployment).DeepCopy()
+		if state, err = popState(&dpl.ObjectMeta); err != nil {
+			break
+		}
+		if state.Replicas != nil {
+			dpl.Spec.Replicas = state.Replicas
+		}
+		_, err = s.Client.AppsV1().Deployments(m.Namespace).Update(context.TODO(), dpl, meta.UpdateOptions{})
+	case "replicaset":
+		rs := obj.(*apps.ReplicaSet).DeepCopy()
+		if state, err = popState(&rs.ObjectMeta); err != nil {
+			break
+		}
+		if state.Replicas != nil {
+			rs.Spec.Replicas = state.Replicas
+		}
+		_, err = s.Client.AppsV1().ReplicaSets(m.Namespace).Update(context.TODO(), rs, meta.UpdateOptions{})
+	case "statefulset":
+		sts := obj.(*apps.StatefulSet).DeepCopy()
+		if state, err = popState(&sts.ObjectMeta); err != nil {
+			break
+		}
+		if state.Replicas != nil {
+			sts.Spec.Replicas = state.Replicas
+		}
+		_, err = s.Client.AppsV1().StatefulSets(m.Namespace).Update(context.TODO(), sts, meta.UpdateOptions{})
+	case "daemonset":
+		ds := obj.(*apps.DaemonSet).DeepCopy()
+		if state, err = popState(&ds.ObjectMeta); err != nil {
+			break
+		}
+		ds.Spec.Template.Spec.NodeSelector = state.NodeSelector
+		_, err = s.Client.AppsV1().DaemonSets(m.Namespace).Update(context.TODO(), ds, meta.UpdateOptions{})
+	case "job":
+		job := obj.(*batch.Job).DeepCopy()
+		if state, err = popState(&job.ObjectMeta); err != nil {
+			break
+		}
+		if state.Suspend != nil {
+			job.Spec.Suspend = state.Suspend
+		}
+		_, err = s.Client.BatchV1().Jobs(m.Namespace).Update(context.TODO(), job, meta.UpdateOptions{})
+	default:
+		err = fmt.Errorf("cannot restore resource of type [%s]", ktype)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[%s] meets standards, restored from suppression", fqname)
+	message := "Resource meets standards and was restored from suppression"
+	s.recordEvent(obj, core.EventTypeNormal, "Restored", message)
+	notifier.Publish(notifier.NewNotification(obj, notifier.TypeRestoration, nil, message))
+	restoredResourcesMetric.With(metricLabels(obj)).Add(1.0)
+	return nil
+}
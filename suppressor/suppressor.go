@@ -1,16 +1,23 @@
 package suppressor
 
 import (
+	"context"
+	"fmt"
 	"github.com/ccpgames/kube-solskin-controller/common"
+	"github.com/ccpgames/kube-solskin-controller/leader"
+	"github.com/ccpgames/kube-solskin-controller/notifier"
+	"github.com/ccpgames/kube-solskin-controller/policy"
+	"github.com/ccpgames/kube-solskin-controller/queue"
 	"github.com/micro/go-config"
 	"github.com/patrickmn/go-cache"
 	"github.com/prometheus/client_golang/prometheus"
 	apps "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
 	core "k8s.io/api/core/v1"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
-	kcache "k8s.io/client-go/tools/cache"
 	"log"
+	"strings"
 	"time"
 )
 
@@ -26,8 +33,43 @@ const (
 
 	// ActionSuppress both logs and suppresses subpar resources.
 	ActionSuppress Action = "suppress"
+
+	// ActionDryRun goes through the whole suppression of subpar resources,
+	// recording how they would be suppressed without suppressing them.
+	ActionDryRun Action = "dryrun"
+)
+
+// JobAction type is an enumeration of the ways the suppressor can suppress a
+// job.
+type JobAction string
+
+const (
+	// JobActionDelete suppresses a job by deleting it along with its pods.
+	JobActionDelete JobAction = "delete"
+
+	// JobActionSuspend suppresses a job by suspending it, which terminates its
+	// running pods and stops new ones from being created while keeping the job
+	// around.
+	JobActionSuspend JobAction = "suspend"
+)
+
+// DaemonSetAction type is an enumeration of the ways the suppressor can
+// suppress a daemonset.
+type DaemonSetAction string
+
+const (
+	// DaemonSetActionDelete suppresses a daemonset by deleting it.
+	DaemonSetActionDelete DaemonSetAction = "delete"
+
+	// DaemonSetActionPark suppresses a daemonset by giving it a node selector
+	// that matches no node, keeping the daemonset and its history intact.
+	DaemonSetActionPark DaemonSetAction = "park"
 )
 
+// ParkingLabel is the node selector label used to park suppressed daemonsets,
+// no node should ever carry this label.
+const ParkingLabel = "solskin.io/suppressed"
+
 var suppressedResourcesMetric = prometheus.NewCounterVec(
 	prometheus.CounterOpts{
 		Help: "Counter of suppressed kubernetes resources.",
@@ -54,11 +96,11 @@ func (s Service) GetSlug() string {
 }
 
 // GenerateEventHandlers returns all event handlers used by this service.
-func (s Service) GenerateEventHandlers() []kcache.ResourceEventHandlerFuncs {
-	return []kcache.ResourceEventHandlerFuncs{
-		kcache.ResourceEventHandlerFuncs{
-			AddFunc:    func(obj interface{}) { s.onObjectChange(obj) },
-			UpdateFunc: func(_, obj interface{}) { s.onObjectChange(obj) },
+func (s Service) GenerateEventHandlers() []queue.Handlers {
+	return []queue.Handlers{
+		queue.Handlers{
+			OnChange: s.onObjectChange,
+			OnDelete: s.onObjectDelete,
 		},
 	}
 }
@@ -67,6 +109,9 @@ func (s Service) GenerateEventHandlers() []kcache.ResourceEventHandlerFuncs {
 func (s Service) Init() {
 	// Initialize the suppressor metrics.
 	prometheus.MustRegister(suppressedResourcesMetric)
+	prometheus.MustRegister(restoredResourcesMetric)
+	prometheus.MustRegister(pendingSuppressionsMetric)
+	prometheus.MustRegister(wouldSuppressMetric)
 }
 
 // Start will start any other components the service needs.
@@ -76,128 +121,322 @@ func (s Service) Start() {
 
 // Called when one of the informers detects either a new or updated kubernetes
 // resource, with the object as the input parameter.
-func (s Service) onObjectChange(obj interface{}) {
-	action := s.Configuration.Get(s.GetSlug(), "action").String(string(ActionLog))
+func (s Service) onObjectChange(obj interface{}) error {
+	// Only the leader suppresses resources when running multiple replicas.
+	if !leader.IsLeader() {
+		return nil
+	}
+
+	// Get the metadata of the resource.
+	m, _ := common.GetObjectMeta(obj)
+	action := s.action(obj)
+
+	// Only dry runs record how the resource would be suppressed.
+	if action != string(ActionDryRun) {
+		clearDryRun(obj)
+	}
 
 	// If we are configured to take no action, simply return.
 	if action == string(ActionNone) {
-		return
+		return nil
 	}
 
-	// Get the metadata of the resource.
-	m, ktype := common.GetObjectMeta(obj)
+	// Grab the unique identifier for the kubernetes resource.
+	uid := string(m.GetUID())
+	fqname := common.GetFullLabel(obj)
+
+	// If we previously suppressed the resource and it now meets standards, or
+	// has since been exempted, restore it to its original state.
+	if isSuppressed(m) && (common.IsExempt(obj, s.Configuration) || !s.toSuppress(obj)) {
+		if err := s.restore(obj); err != nil {
+			return fmt.Errorf("could not be restored: %s", err)
+		}
+		c.Delete(uid)
+		return nil
+	}
+
+	// A resource we previously suppressed that still fails to meet standards
+	// is left as it is, only the cache entry saying so may have expired.
+	if isSuppressed(m) {
+		return nil
+	}
 
 	// Determine if the resource is eligible for suppression, if not skip it.
 	if !common.IsEligible(obj, s.Configuration) {
-		log.Printf("[%s] object in namespace [%s], not eligible", common.GetFullLabel(obj), m.GetNamespace())
-		return
+		log.Printf("[%s] object in namespace [%s], not eligible", fqname, m.GetNamespace())
+		clearDryRun(obj)
+		return nil
 	}
 
-	// Grab the unique identifier for the kubernetes resource.
-	uid := string(m.GetUID())
-
 	// Check to see if the resource has already been suppressed.
-	fqname := common.GetFullLabel(obj)
 	v, found := c.Get(uid)
 	if found && v.(bool) {
-		return
+		return nil
 	}
 	c.Set(uid, false, cache.DefaultExpiration)
 
 	// If we don't need to suppress to object, simply return.
-	if !s.toSuppress(obj) {
+	failures := s.failedChecks(obj)
+	if len(failures) == 0 {
 		log.Printf("[%s] meets standards, will not suppress", fqname)
-		return
+		s.cancelSchedule(obj)
+		clearDryRun(obj)
+		return nil
 	}
 
-	// If our configured action is anything other than suppress, exit early.
-	if action != string(ActionSuppress) {
-		return
+	// If our configured action is anything other than suppress, or a dry run
+	// of it, exit early.
+	if action != string(ActionSuppress) && action != string(ActionDryRun) {
+		return nil
 	}
 
-	// Increment our metric counter by one.
-	suppressedResourcesMetric.With(map[string]string{
-		"name":          m.GetName(),
-		"namespace":     m.GetNamespace(),
-		"resource_type": ktype,
-	}).Add(1.0)
+	// Pods managed by a controller would simply be recreated, so suppress the
+	// top-level workload owning the pod instead.
+	target, err := s.suppressionTarget(obj)
+	if err != nil {
+		return fmt.Errorf("could not determine suppression target: %s", err)
+	}
+	tm, _ := common.GetObjectMeta(target)
+	tuid := string(tm.GetUID())
+	if target != obj {
+		v, found := c.Get(tuid)
+		if found && v.(bool) {
+			return nil
+		}
+
+		// The owner is only suppressed when it fails to meet standards itself,
+		// e.g. pods failing because of containers injected into them don't get
+		// their compliant owner suppressed.
+		if !common.IsEligible(target, s.Configuration) {
+			log.Printf("[%s] is owned by [%s], which is not eligible", fqname, common.GetFullLabel(target))
+			return nil
+		}
+		action = s.action(target)
+		if action != string(ActionSuppress) && action != string(ActionDryRun) {
+			return nil
+		}
+		if failures = s.failedChecks(target); len(failures) == 0 {
+			log.Printf("[%s] is owned by [%s], which meets standards, will not suppress", fqname, common.GetFullLabel(target))
+			return nil
+		}
+		log.Printf("[%s] is owned by [%s], which will be suppressed instead", fqname, common.GetFullLabel(target))
+	}
 
-	// If the resource is eligible then we have to suppress it, which will depend
-	// on the type of the resource.
-	opts := &meta.DeleteOptions{}
-	c.Set(uid, true, cache.DefaultExpiration)
+	// Dry runs stop short of actually suppressing anything.
+	if action == string(ActionDryRun) {
+		return s.dryRun(obj, target, failures)
+	}
+
+	// Give the owners of the resource time to react before suppressing it.
+	if !s.graceExpired(target, failures) {
+		return nil
+	}
 
 	// Perform the suppression of the resource only if we're configured to do so.
-	log.Printf("[%s] will be suppressed", fqname)
+	log.Printf("[%s] will be suppressed", common.GetFullLabel(target))
+	c.Set(tuid, true, cache.DefaultExpiration)
+	description, err := s.suppress(target)
+	if err != nil {
+		c.Delete(tuid)
+		return fmt.Errorf("could not suppress [%s]: %s", common.GetFullLabel(target), err)
+	}
+
+	// Increment our metric counter by one.
+	suppressedResourcesMetric.With(metricLabels(target)).Add(1.0)
+
+	// Let the owners of the resource know what happened and why.
+	if target != obj {
+		description = fmt.Sprintf("its owner %s was %s", common.GetFullLabel(target), description)
+	} else {
+		description = fmt.Sprintf("was %s", description)
+	}
+	message := fmt.Sprintf(
+		"Resource does not meet %s requirements and %s",
+		strings.Join(failures, ", "),
+		description,
+	)
+	s.recordEvent(obj, core.EventTypeWarning, "Suppressed", message)
+	notifier.Publish(notifier.NewNotification(target, notifier.TypeSuppression, failures, message))
+	return nil
+}
+
+// Helper function to determine the resource to suppress in order to suppress
+// the given resource, which for pods is the top-level workload owning them.
+func (s Service) suppressionTarget(obj interface{}) (interface{}, error) {
+	if _, ktype := common.GetObjectMeta(obj); ktype != "pod" {
+		return obj, nil
+	}
+	return common.GetRootOwner(obj)
+}
+
+// Suppresses the resource in a manner depending on its type, returning a
+// description of what was done.
+func (s Service) suppress(obj interface{}) (string, error) {
+	m, ktype := common.GetObjectMeta(obj)
+	opts := meta.DeleteOptions{}
+
+	var err error
+	var description string
 	switch ktype {
 	case "pod":
 		pod := obj.(*core.Pod)
 
 		// To suppress a pod, we simply delete it.
-		s.Client.Core().Pods(m.Namespace).Delete(pod.GetName(), opts)
+		description = "deleted"
+		err = s.Client.CoreV1().Pods(m.Namespace).Delete(context.TODO(), pod.GetName(), opts)
 	case "deployment":
-		dpl := obj.(*apps.Deployment)
+		dpl := obj.(*apps.Deployment).DeepCopy()
 
-		// To suppress a deployment, we set the replicas to zero.
+		// To suppress a deployment, we record the original replica count and then
+		// set the replicas to zero.
+		if !isSuppressed(m) {
+			setState(&dpl.ObjectMeta, State{Replicas: replicasOf(dpl.Spec.Replicas)})
+		}
 		replicas := int32(0)
 		dpl.Spec.Replicas = &replicas
-		s.Client.Apps().Deployments(m.Namespace).Update(dpl)
+		description = "scaled to zero replicas"
+		_, err = s.Client.AppsV1().Deployments(m.Namespace).Update(context.TODO(), dpl, meta.UpdateOptions{})
 	case "daemonset":
-		ds := obj.(*apps.DaemonSet)
+		ds := obj.(*apps.DaemonSet).DeepCopy()
+
+		// To suppress a daemonset, we either park or delete it based on
+		// configuration.
+		switch s.daemonSetAction() {
+		case DaemonSetActionPark:
+			if !isSuppressed(m) {
+				setState(&ds.ObjectMeta, State{NodeSelector: ds.Spec.Template.Spec.NodeSelector})
+			}
+			ds.Spec.Template.Spec.NodeSelector = map[string]string{ParkingLabel: "true"}
+			description = "parked on a node selector matching no node"
+			_, err = s.Client.AppsV1().DaemonSets(m.Namespace).Update(context.TODO(), ds, meta.UpdateOptions{})
+		default:
+			description = "deleted"
+			err = s.Client.AppsV1().DaemonSets(m.Namespace).Delete(context.TODO(), ds.GetName(), opts)
+		}
+	case "replicaset":
+		rs := obj.(*apps.ReplicaSet).DeepCopy()
 
-		// To suppress a daemonset, we simply delete it.
-		s.Client.Apps().DaemonSets(m.Namespace).Delete(ds.GetName(), opts)
+		// To suppress a replicaset not managed by a deployment, we record the
+		// original replica count and then set the replicas to zero.
+		if !isSuppressed(m) {
+			setState(&rs.ObjectMeta, State{Replicas: replicasOf(rs.Spec.Replicas)})
+		}
+		replicas := int32(0)
+		rs.Spec.Replicas = &replicas
+		description = "scaled to zero replicas"
+		_, err = s.Client.AppsV1().ReplicaSets(m.Namespace).Update(context.TODO(), rs, meta.UpdateOptions{})
+	case "statefulset":
+		sts := obj.(*apps.StatefulSet).DeepCopy()
+
+		// To suppress a statefulset, we record the original replica count and then
+		// set the replicas to zero.
+		if !isSuppressed(m) {
+			setState(&sts.ObjectMeta, State{Replicas: replicasOf(sts.Spec.Replicas)})
+		}
+		replicas := int32(0)
+		sts.Spec.Replicas = &replicas
+		description = "scaled to zero replicas"
+		_, err = s.Client.AppsV1().StatefulSets(m.Namespace).Update(context.TODO(), sts, meta.UpdateOptions{})
+	case "job":
+		job := obj.(*batch.Job).DeepCopy()
+
+		// To suppress a job, we either suspend or delete it based on configuration.
+		switch s.jobAction() {
+		case JobActionSuspend:
+			if !isSuppressed(m) {
+				setState(&job.ObjectMeta, State{Suspend: suspendOf(job.Spec.Suspend)})
+			}
+			suspend := true
+			job.Spec.Suspend = &suspend
+			description = "suspended"
+			_, err = s.Client.BatchV1().Jobs(m.Namespace).Update(context.TODO(), job, meta.UpdateOptions{})
+		default:
+			// Jobs orphan their pods by default, so make sure they are cleaned up too.
+			propagation := meta.DeletePropagationBackground
+			opts.PropagationPolicy = &propagation
+			description = "deleted"
+			err = s.Client.BatchV1().Jobs(m.Namespace).Delete(context.TODO(), job.GetName(), opts)
+		}
+	default:
+		err = fmt.Errorf("cannot suppress resource of type [%s]", ktype)
 	}
+
+	return description, err
 }
 
-// Helper function to determine if the resource should be suppressed.
-func (s Service) toSuppress(obj interface{}) bool {
-	// Determine the suppression decision.
-	suppression := false
-	_, ktype := common.GetObjectMeta(obj)
-	switch ktype {
-	case "pod":
-		suppression = s.toSuppressPod(obj.(*core.Pod))
-	case "deployment":
-		suppression = s.toSuppressDeployment(obj.(*apps.Deployment))
-	case "daemonset":
-		suppression = s.toSuppressDaemonSet(obj.(*apps.DaemonSet))
-	}
-	return suppression
+// Helper function to determine how to suppress daemonsets.
+func (s Service) daemonSetAction() DaemonSetAction {
+	return DaemonSetAction(s.Configuration.Get(s.GetSlug(), "daemonset", "action").String(string(DaemonSetActionDelete)))
 }
 
-// Helper function to determine if the pod should be suppressed.
-func (s Service) toSuppressPod(pod *core.Pod) bool {
-	return toSuppress(pod, pod.ObjectMeta, pod.Spec)
+// Helper function to determine how to suppress jobs.
+func (s Service) jobAction() JobAction {
+	return JobAction(s.Configuration.Get(s.GetSlug(), "job", "action").String(string(JobActionDelete)))
 }
 
-// Helper function to determine if the deployment should be suppressed.
-func (s Service) toSuppressDeployment(dpl *apps.Deployment) bool {
-	return toSuppress(dpl, dpl.Spec.Template.ObjectMeta, dpl.Spec.Template.Spec)
+// Called when one of the informers detects a deleted kubernetes resource,
+// with the object as the input parameter.
+func (s Service) onObjectDelete(obj interface{}) error {
+	clearDryRun(obj)
+	return nil
 }
 
-// Helper function to determine if the daemonset should be suppressed.
-func (s Service) toSuppressDaemonSet(ds *apps.DaemonSet) bool {
-	return toSuppress(ds, ds.Spec.Template.ObjectMeta, ds.Spec.Template.Spec)
+// Helper function to determine the action to take for the resource, which a
+// policy or the resource's namespace can override.
+func (s Service) action(obj interface{}) string {
+	action := s.Configuration.Get(s.GetSlug(), "action").String(string(ActionLog))
+	m, _ := common.GetObjectMeta(obj)
+	namespace := m.GetNamespace()
+	if value, ok := common.GetNamespaceSetting(namespace, common.NamespaceActionLabel); ok {
+		if isValidAction(value) {
+			action = value
+		} else {
+			log.Printf("namespace [%s] has unknown action [%s], defaulting to [%s]", namespace, value, action)
+		}
+	}
+
+	if p := policy.Find(obj); p != nil && p.Action != "" {
+		if isValidAction(p.Action) {
+			action = p.Action
+		} else {
+			log.Printf("[%s] policy has unknown action [%s], defaulting to [%s]", common.GetFullLabel(obj), p.Action, action)
+		}
+	}
+	return action
 }
 
-// Helper function to determine if a resource meets suppression.
-func toSuppress(obj interface{}, m meta.ObjectMeta, spec core.PodSpec) bool {
-	checks := map[string]bool{
-		"observability": common.HasObservability(m),
-		"liveness":      common.HasLiveness(spec),
-		"readiness":     common.HasReadiness(spec),
-		"requests":      common.HasRequests(spec),
-		"limits":        common.HasLimits(spec),
+// Helper function to determine if the value is a known action.
+func isValidAction(value string) bool {
+	switch Action(value) {
+	case ActionNone, ActionLog, ActionSuppress, ActionDryRun:
+		return true
 	}
+	return false
+}
+
+// Helper function to determine if the resource should be suppressed.
+func (s Service) toSuppress(obj interface{}) bool {
+	return len(s.failedChecks(obj)) > 0
+}
 
-	values := []bool{}
-	for k, v := range checks {
-		if !v {
-			log.Printf("[%s] does not meet %s requirements", common.GetFullLabel(obj), k)
+// Helper function to determine which checks the resource fails, leaving out
+// the checks that are only reported rather than suppressed.
+func (s Service) failedChecks(obj interface{}) []string {
+	failures := []string{}
+	for _, evaluation := range common.EvaluateChecks(obj, s.Configuration, policy.IncludeFunc(obj, s.Configuration)) {
+		name := evaluation.Check.Name()
+		if evaluation.Result.Passed || !common.IsCheckSuppressing(name, s.Configuration) {
+			continue
 		}
+		log.Printf("[%s] does not meet %s requirements: %s", common.GetFullLabel(obj), name, evaluation.Result.Reason)
+		failures = append(failures, name)
+	}
+	return failures
+}
 
-		values = append(values, v)
+// Helper function to record an event on the resource and its owner.
+func (s Service) recordEvent(obj interface{}, etype, reason, message string) {
+	if err := common.RecordEventWithOwner(obj, etype, reason, message); err != nil {
+		log.Printf("[%s] could not record event: %s", common.GetFullLabel(obj), err)
 	}
-	return !common.PassesChecks(values)
 }
@@ -1,12 +1,24 @@
 package suppressor
 
 import (
+	"context"
+	"github.com/ccpgames/kube-solskin-controller/common"
+	"github.com/ccpgames/kube-solskin-controller/policy"
 	config "github.com/micro/go-config"
+	"github.com/micro/go-config/source/env"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	apps "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
 	core "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"os"
 	"testing"
 )
 
@@ -35,25 +47,37 @@ func TestSuppressionDecision(t *testing.T) {
 			Resource: &apps.DaemonSet{},
 		},
 
+		// StatefulSet without any standards.
+		ResourceTest{
+			Expected: true,
+			Resource: &apps.StatefulSet{},
+		},
+
+		// Job without any standards.
+		ResourceTest{
+			Expected: true,
+			Resource: &batch.Job{},
+		},
+
 		// Pod with all proper standards.
 		ResourceTest{
 			Expected: false,
 			Resource: &core.Pod{
 				ObjectMeta: meta.ObjectMeta{
 					Annotations: map[string]string{
-						"prometheus.io/scrape": "false",
+						"prometheus.io/scrape": "true",
 					},
 				},
 				Spec: core.PodSpec{
 					Containers: []core.Container{
 						core.Container{
 							LivenessProbe: &core.Probe{
-								Handler: core.Handler{
+								ProbeHandler: core.ProbeHandler{
 									Exec: &core.ExecAction{},
 								},
 							},
 							ReadinessProbe: &core.Probe{
-								Handler: core.Handler{
+								ProbeHandler: core.ProbeHandler{
 									Exec: &core.ExecAction{},
 								},
 							},
@@ -81,19 +105,19 @@ func TestSuppressionDecision(t *testing.T) {
 					Template: core.PodTemplateSpec{
 						ObjectMeta: meta.ObjectMeta{
 							Annotations: map[string]string{
-								"prometheus.io/scrape": "false",
+								"prometheus.io/scrape": "true",
 							},
 						},
 						Spec: core.PodSpec{
 							Containers: []core.Container{
 								core.Container{
 									LivenessProbe: &core.Probe{
-										Handler: core.Handler{
+										ProbeHandler: core.ProbeHandler{
 											Exec: &core.ExecAction{},
 										},
 									},
 									ReadinessProbe: &core.Probe{
-										Handler: core.Handler{
+										ProbeHandler: core.ProbeHandler{
 											Exec: &core.ExecAction{},
 										},
 									},
@@ -124,3 +148,445 @@ func TestSuppressionDecision(t *testing.T) {
 		assert.Exactly(t, test.Expected, actual)
 	}
 }
+
+func TestSuppressStatefulSetAndJob(t *testing.T) {
+	os.Setenv("SOLSKIN_SUPPRESSOR_ACTION", "suppress")
+	os.Setenv("SOLSKIN_SUPPRESSOR_JOB_ACTION", "suspend")
+	defer os.Unsetenv("SOLSKIN_SUPPRESSOR_ACTION")
+	defer os.Unsetenv("SOLSKIN_SUPPRESSOR_JOB_ACTION")
+	cfg := config.NewConfig()
+	cfg.Load(env.NewSource(env.WithStrippedPrefix("SOLSKIN")))
+
+	replicas := int32(3)
+	sts := &apps.StatefulSet{
+		ObjectMeta: meta.ObjectMeta{Name: "sts", Namespace: "default", UID: "sts"},
+		Spec:       apps.StatefulSetSpec{Replicas: &replicas},
+	}
+	parallelism := int32(2)
+	job := &batch.Job{
+		ObjectMeta: meta.ObjectMeta{Name: "job", Namespace: "default", UID: "job"},
+		Spec:       batch.JobSpec{Parallelism: &parallelism},
+	}
+
+	client := fake.NewSimpleClientset(sts, job)
+	s := Service{Client: client, Configuration: cfg}
+	s.onObjectChange(sts.DeepCopy())
+	s.onObjectChange(job.DeepCopy())
+
+	// The statefulset should be scaled down to zero replicas.
+	actualSts, err := client.AppsV1().StatefulSets("default").Get(context.TODO(), "sts", meta.GetOptions{})
+	assert.NoError(t, err)
+	assert.Exactly(t, int32(0), *actualSts.Spec.Replicas)
+
+	// The job should have been suspended rather than deleted.
+	actualJob, err := client.BatchV1().Jobs("default").Get(context.TODO(), "job", meta.GetOptions{})
+	assert.NoError(t, err)
+	assert.True(t, *actualJob.Spec.Suspend)
+	assert.Exactly(t, int32(2), *actualJob.Spec.Parallelism)
+
+	// Once the job meets standards, it should be resumed.
+	actualJob.Spec.Template = compliantTemplate()
+	s.onObjectChange(actualJob)
+	restored, err := client.BatchV1().Jobs("default").Get(context.TODO(), "job", meta.GetOptions{})
+	assert.NoError(t, err)
+	assert.False(t, *restored.Spec.Suspend)
+}
+
+func TestRestoreOnCompliance(t *testing.T) {
+	os.Setenv("SOLSKIN_SUPPRESSOR_ACTION", "suppress")
+	defer os.Unsetenv("SOLSKIN_SUPPRESSOR_ACTION")
+	cfg := config.NewConfig()
+	cfg.Load(env.NewSource(env.WithStrippedPrefix("SOLSKIN")))
+
+	replicas := int32(3)
+	dpl := &apps.Deployment{
+		ObjectMeta: meta.ObjectMeta{Name: "dpl", Namespace: "default", UID: "dpl"},
+		Spec:       apps.DeploymentSpec{Replicas: &replicas},
+	}
+
+	client := fake.NewSimpleClientset(dpl)
+	s := Service{Client: client, Configuration: cfg}
+
+	// The deployment should be suppressed with its original state recorded.
+	s.onObjectChange(dpl.DeepCopy())
+	suppressed, err := client.AppsV1().Deployments("default").Get(context.TODO(), "dpl", meta.GetOptions{})
+	assert.NoError(t, err)
+	assert.Exactly(t, int32(0), *suppressed.Spec.Replicas)
+	assert.Contains(t, suppressed.GetAnnotations(), StateAnnotation)
+
+	// Once the deployment meets standards, it should be restored.
+	suppressed.Spec.Template = compliantTemplate()
+	s.onObjectChange(suppressed)
+	restored, err := client.AppsV1().Deployments("default").Get(context.TODO(), "dpl", meta.GetOptions{})
+	assert.NoError(t, err)
+	assert.Exactly(t, int32(3), *restored.Spec.Replicas)
+	assert.NotContains(t, restored.GetAnnotations(), StateAnnotation)
+}
+
+func TestSuppressOnce(t *testing.T) {
+	os.Setenv("SOLSKIN_SUPPRESSOR_ACTION", "suppress")
+	defer os.Unsetenv("SOLSKIN_SUPPRESSOR_ACTION")
+	cfg := config.NewConfig()
+	cfg.Load(env.NewSource(env.WithStrippedPrefix("SOLSKIN")))
+
+	replicas := int32(3)
+	dpl := &apps.Deployment{
+		ObjectMeta: meta.ObjectMeta{Name: "once", Namespace: "default", UID: "once"},
+		Spec:       apps.DeploymentSpec{Replicas: &replicas},
+	}
+
+	client := fake.NewSimpleClientset(dpl)
+	s := Service{Client: client, Configuration: cfg}
+	s.onObjectChange(dpl.DeepCopy())
+
+	// Once the cache entry is gone, the suppressed deployment should still not
+	// be suppressed a second time.
+	suppressed, err := client.AppsV1().Deployments("default").Get(context.TODO(), "once", meta.GetOptions{})
+	assert.NoError(t, err)
+	c.Delete("once")
+	s.onObjectChange(suppressed)
+
+	counter := suppressedResourcesMetric.With(metricLabels(dpl))
+	assert.Exactly(t, 1.0, testutil.ToFloat64(counter))
+
+	actual, err := client.AppsV1().Deployments("default").Get(context.TODO(), "once", meta.GetOptions{})
+	assert.NoError(t, err)
+	assert.Exactly(t, suppressed.GetAnnotations()[StateAnnotation], actual.GetAnnotations()[StateAnnotation])
+}
+
+// Helper function to create a pod template that meets all standards.
+func compliantTemplate() core.PodTemplateSpec {
+	return core.PodTemplateSpec{
+		ObjectMeta: meta.ObjectMeta{
+			Annotations: map[string]string{
+				"prometheus.io/scrape": "true",
+			},
+		},
+		Spec: core.PodSpec{
+			Containers: []core.Container{
+				core.Container{
+					LivenessProbe: &core.Probe{
+						ProbeHandler: core.ProbeHandler{
+							Exec: &core.ExecAction{},
+						},
+					},
+					ReadinessProbe: &core.Probe{
+						ProbeHandler: core.ProbeHandler{
+							Exec: &core.ExecAction{},
+						},
+					},
+					Resources: core.ResourceRequirements{
+						Requests: core.ResourceList{
+							core.ResourceCPU:    *resource.NewScaledQuantity(1, resource.Mega),
+							core.ResourceMemory: *resource.NewScaledQuantity(1, resource.Mega),
+						},
+						Limits: core.ResourceList{
+							core.ResourceCPU:    *resource.NewScaledQuantity(1, resource.Mega),
+							core.ResourceMemory: *resource.NewScaledQuantity(1, resource.Mega),
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestParkDaemonSet(t *testing.T) {
+	os.Setenv("SOLSKIN_SUPPRESSOR_ACTION", "suppress")
+	os.Setenv("SOLSKIN_SUPPRESSOR_DAEMONSET_ACTION", "park")
+	defer os.Unsetenv("SOLSKIN_SUPPRESSOR_ACTION")
+	defer os.Unsetenv("SOLSKIN_SUPPRESSOR_DAEMONSET_ACTION")
+	cfg := config.NewConfig()
+	cfg.Load(env.NewSource(env.WithStrippedPrefix("SOLSKIN")))
+
+	ds := &apps.DaemonSet{
+		ObjectMeta: meta.ObjectMeta{Name: "ds", Namespace: "default", UID: "ds"},
+		Spec: apps.DaemonSetSpec{
+			Template: core.PodTemplateSpec{
+				Spec: core.PodSpec{
+					NodeSelector: map[string]string{"role": "worker"},
+				},
+			},
+		},
+	}
+
+	client := fake.NewSimpleClientset(ds)
+	s := Service{Client: client, Configuration: cfg}
+
+	// The daemonset should be parked rather than deleted.
+	s.onObjectChange(ds.DeepCopy())
+	parked, err := client.AppsV1().DaemonSets("default").Get(context.TODO(), "ds", meta.GetOptions{})
+	assert.NoError(t, err)
+	assert.Exactly(t, map[string]string{ParkingLabel: "true"}, parked.Spec.Template.Spec.NodeSelector)
+
+	// Once the daemonset meets standards, its node selector should be restored.
+	template := compliantTemplate()
+	template.Spec.NodeSelector = parked.Spec.Template.Spec.NodeSelector
+	parked.Spec.Template = template
+	s.onObjectChange(parked)
+	restored, err := client.AppsV1().DaemonSets("default").Get(context.TODO(), "ds", meta.GetOptions{})
+	assert.NoError(t, err)
+	assert.Exactly(t, map[string]string{"role": "worker"}, restored.Spec.Template.Spec.NodeSelector)
+}
+
+func TestGracePeriod(t *testing.T) {
+	os.Setenv("SOLSKIN_SUPPRESSOR_ACTION", "suppress")
+	os.Setenv("SOLSKIN_SUPPRESSOR_GRACE", "24h")
+	defer os.Unsetenv("SOLSKIN_SUPPRESSOR_ACTION")
+	defer os.Unsetenv("SOLSKIN_SUPPRESSOR_GRACE")
+	cfg := config.NewConfig()
+	cfg.Load(env.NewSource(env.WithStrippedPrefix("SOLSKIN")))
+
+	replicas := int32(3)
+	dpl := &apps.Deployment{
+		ObjectMeta: meta.ObjectMeta{Name: "grace", Namespace: "default", UID: "grace"},
+		Spec:       apps.DeploymentSpec{Replicas: &replicas},
+	}
+
+	client := fake.NewSimpleClientset(dpl)
+	recorder := record.NewFakeRecorder(10)
+	common.SetEventRecorder(recorder)
+	defer common.SetEventRecorder(&record.FakeRecorder{})
+	s := Service{Client: client, Configuration: cfg}
+
+	// The deployment should only be scheduled for suppression, with an event.
+	s.onObjectChange(dpl.DeepCopy())
+	scheduled, err := client.AppsV1().Deployments("default").Get(context.TODO(), "grace", meta.GetOptions{})
+	assert.NoError(t, err)
+	assert.Exactly(t, int32(3), *scheduled.Spec.Replicas)
+	assert.Contains(t, scheduled.GetAnnotations(), ScheduleAnnotation)
+
+	assert.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "Warning SuppressionScheduled")
+
+	// Once the deadline has passed, the deployment should be suppressed.
+	scheduled.Annotations[ScheduleAnnotation] = "2000-01-01T00:00:00Z"
+	c.Delete("grace")
+	s.onObjectChange(scheduled)
+	suppressed, err := client.AppsV1().Deployments("default").Get(context.TODO(), "grace", meta.GetOptions{})
+	assert.NoError(t, err)
+	assert.Exactly(t, int32(0), *suppressed.Spec.Replicas)
+}
+
+func TestSkippedChecks(t *testing.T) {
+	template := compliantTemplate()
+	template.Spec.Containers[0].LivenessProbe = nil
+	dpl := &apps.Deployment{Spec: apps.DeploymentSpec{Template: template}}
+
+	s := Service{Configuration: config.NewConfig()}
+	assert.Exactly(t, []string{"liveness"}, s.failedChecks(dpl))
+
+	// Skipping the failing check should stop the deployment from being
+	// suppressed.
+	dpl.Annotations = map[string]string{common.SkipChecksAnnotation: "liveness"}
+	assert.False(t, s.toSuppress(dpl))
+}
+
+func TestNamespaceAction(t *testing.T) {
+	common.SetNamespace(&core.Namespace{ObjectMeta: meta.ObjectMeta{
+		Name:   "enforced",
+		Labels: map[string]string{common.NamespaceActionLabel: "suppress"},
+	}})
+	common.SetNamespace(&core.Namespace{ObjectMeta: meta.ObjectMeta{
+		Name:   "unknown",
+		Labels: map[string]string{common.NamespaceActionLabel: "unknown"},
+	}})
+	defer common.DeleteNamespace("enforced")
+	defer common.DeleteNamespace("unknown")
+
+	pod := func(namespace string) *core.Pod {
+		return &core.Pod{ObjectMeta: meta.ObjectMeta{Namespace: namespace}}
+	}
+
+	s := Service{Configuration: config.NewConfig()}
+	assert.Exactly(t, string(ActionSuppress), s.action(pod("enforced")))
+	assert.Exactly(t, string(ActionLog), s.action(pod("unknown")))
+	assert.Exactly(t, string(ActionLog), s.action(pod("default")))
+}
+
+func TestPolicy(t *testing.T) {
+	p := &policy.SolskinPolicy{
+		ObjectMeta: meta.ObjectMeta{Name: "batch", Namespace: "default"},
+		Spec: policy.Spec{
+			Checks: []string{"requests", "limits"},
+			Kinds:  []string{"job"},
+			Action: "none",
+		},
+	}
+	policy.SetPolicy(p)
+	defer policy.DeletePolicy(p)
+
+	job := &batch.Job{ObjectMeta: meta.ObjectMeta{Namespace: "default"}}
+	pod := &core.Pod{ObjectMeta: meta.ObjectMeta{Namespace: "default"}}
+
+	// Only the resources matching the policy are affected by it.
+	s := Service{Configuration: config.NewConfig()}
+	assert.Exactly(t, string(ActionNone), s.action(job))
+	assert.Exactly(t, []string{"requests", "limits"}, s.failedChecks(job))
+	assert.Exactly(t, string(ActionLog), s.action(pod))
+	assert.Len(t, s.failedChecks(pod), 5)
+}
+
+func TestSuppressOwner(t *testing.T) {
+	os.Setenv("SOLSKIN_SUPPRESSOR_ACTION", "suppress")
+	defer os.Unsetenv("SOLSKIN_SUPPRESSOR_ACTION")
+	cfg := config.NewConfig()
+	cfg.Load(env.NewSource(env.WithStrippedPrefix("SOLSKIN")))
+
+	controller := true
+	replicas := int32(2)
+	deployment := func(name string, template core.PodTemplateSpec) *apps.Deployment {
+		return &apps.Deployment{
+			ObjectMeta: meta.ObjectMeta{Name: name, Namespace: "default", UID: types.UID(name)},
+			Spec:       apps.DeploymentSpec{Replicas: &replicas, Template: template},
+		}
+	}
+	rs := func(owner string) *apps.ReplicaSet {
+		return &apps.ReplicaSet{
+			ObjectMeta: meta.ObjectMeta{
+				Name:      owner + "-1234",
+				Namespace: "default",
+				UID:       types.UID(owner + "-1234"),
+				OwnerReferences: []meta.OwnerReference{
+					meta.OwnerReference{Kind: "Deployment", Name: owner, Controller: &controller},
+				},
+			},
+		}
+	}
+	pod := func(owner string, name string) *core.Pod {
+		return &core.Pod{
+			ObjectMeta: meta.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				UID:       types.UID(name),
+				OwnerReferences: []meta.OwnerReference{
+					meta.OwnerReference{Kind: "ReplicaSet", Name: owner + "-1234", Controller: &controller},
+				},
+			},
+		}
+	}
+	bare := &core.Pod{ObjectMeta: meta.ObjectMeta{Name: "bare", Namespace: "default", UID: "bare"}}
+
+	client := fake.NewSimpleClientset(
+		deployment("owner", core.PodTemplateSpec{}),
+		rs("owner"),
+		pod("owner", "owner-1234-a"),
+		pod("owner", "owner-1234-b"),
+		deployment("compliant", compliantTemplate()),
+		rs("compliant"),
+		pod("compliant", "compliant-1234-a"),
+		bare,
+	)
+	setOwnerListers(t, client)
+	s := Service{Client: client, Configuration: cfg}
+	s.onObjectChange(pod("owner", "owner-1234-a"))
+	s.onObjectChange(pod("owner", "owner-1234-b"))
+	s.onObjectChange(pod("compliant", "compliant-1234-a"))
+	s.onObjectChange(bare)
+
+	// The owned pods should be left alone, with their deployment suppressed.
+	pods, err := client.CoreV1().Pods("default").List(context.TODO(), meta.ListOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, pods.Items, 3)
+
+	suppressed, err := client.AppsV1().Deployments("default").Get(context.TODO(), "owner", meta.GetOptions{})
+	assert.NoError(t, err)
+	assert.Exactly(t, int32(0), *suppressed.Spec.Replicas)
+	assert.Contains(t, suppressed.GetAnnotations(), StateAnnotation)
+
+	// Subpar pods of a deployment meeting standards, e.g. because of injected
+	// containers, should not have it suppressed.
+	compliant, err := client.AppsV1().Deployments("default").Get(context.TODO(), "compliant", meta.GetOptions{})
+	assert.NoError(t, err)
+	assert.Exactly(t, int32(2), *compliant.Spec.Replicas)
+	assert.NotContains(t, compliant.GetAnnotations(), StateAnnotation)
+
+	// The bare pod should have been deleted.
+	_, err = client.CoreV1().Pods("default").Get(context.TODO(), "bare", meta.GetOptions{})
+	assert.Error(t, err)
+}
+
+// Helper function to look up owners through synced informers over the client.
+func setOwnerListers(t *testing.T, client kubernetes.Interface) {
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+
+	factory := informers.NewSharedInformerFactory(client, 0)
+	common.SetOwnerListers(factory)
+	factory.Start(stop)
+	factory.WaitForCacheSync(stop)
+}
+
+func TestDryRun(t *testing.T) {
+	os.Setenv("SOLSKIN_SUPPRESSOR_ACTION", "dryrun")
+	defer os.Unsetenv("SOLSKIN_SUPPRESSOR_ACTION")
+	cfg := config.NewConfig()
+	cfg.Load(env.NewSource(env.WithStrippedPrefix("SOLSKIN")))
+
+	controller := true
+	replicas := int32(2)
+	dpl := &apps.Deployment{
+		ObjectMeta: meta.ObjectMeta{Name: "dry", Namespace: "default", UID: "dry"},
+		Spec:       apps.DeploymentSpec{Replicas: &replicas},
+	}
+	pod := &core.Pod{
+		ObjectMeta: meta.ObjectMeta{
+			Name:      "dry-a",
+			Namespace: "default",
+			UID:       "dry-a",
+			OwnerReferences: []meta.OwnerReference{
+				meta.OwnerReference{Kind: "Deployment", Name: "dry", Controller: &controller},
+			},
+		},
+	}
+
+	client := fake.NewSimpleClientset(dpl, pod)
+	setOwnerListers(t, client)
+	s := Service{Client: client, Configuration: cfg}
+	assert.NoError(t, s.onObjectChange(pod.DeepCopy()))
+
+	// Nothing should have been suppressed, but the decision recorded.
+	unchanged, err := client.AppsV1().Deployments("default").Get(context.TODO(), "dry", meta.GetOptions{})
+	assert.NoError(t, err)
+	assert.Exactly(t, int32(2), *unchanged.Spec.Replicas)
+	_, err = client.CoreV1().Pods("default").Get(context.TODO(), "dry-a", meta.GetOptions{})
+	assert.NoError(t, err)
+
+	labels, ok := dryRuns.m[common.GetFullLabel(pod)]
+	assert.True(t, ok)
+	assert.Exactly(t, "deployment:dry.default", labels["target"])
+	assert.Exactly(t, "scale to zero replicas", labels["action"])
+
+	// Once the pod is deleted, so is its decision.
+	assert.NoError(t, s.onObjectDelete(pod))
+	assert.NotContains(t, dryRuns.m, common.GetFullLabel(pod))
+}
+
+func TestSuppressingChecks(t *testing.T) {
+	os.Setenv("SOLSKIN_CHECKS_PRIVILEGED_ENABLED", "true")
+	os.Setenv("SOLSKIN_CHECKS_HOST_NAMESPACES_ENABLED", "true")
+	os.Setenv("SOLSKIN_CHECKS_HOST_NAMESPACES_SUPPRESS", "true")
+	os.Setenv("SOLSKIN_CHECKS_LIVENESS_SUPPRESS", "false")
+	defer os.Unsetenv("SOLSKIN_CHECKS_PRIVILEGED_ENABLED")
+	defer os.Unsetenv("SOLSKIN_CHECKS_HOST_NAMESPACES_ENABLED")
+	defer os.Unsetenv("SOLSKIN_CHECKS_HOST_NAMESPACES_SUPPRESS")
+	defer os.Unsetenv("SOLSKIN_CHECKS_LIVENESS_SUPPRESS")
+	cfg := config.NewConfig()
+	cfg.Load(env.NewSource(env.WithStrippedPrefix("SOLSKIN")))
+
+	privileged := true
+	pod := &core.Pod{
+		ObjectMeta: meta.ObjectMeta{Namespace: "default"},
+		Spec: core.PodSpec{
+			HostNetwork: true,
+			Containers: []core.Container{
+				core.Container{Name: "app", SecurityContext: &core.SecurityContext{Privileged: &privileged}},
+			},
+		},
+	}
+
+	// Failing checks that don't suppress are left out, which optional checks
+	// only do when asked to.
+	s := Service{Configuration: cfg}
+	assert.Exactly(t, []string{"observability", "readiness", "requests", "limits", "host-namespaces"}, s.failedChecks(pod))
+}
@@ -0,0 +1,219 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ccpgames/kube-solskin-controller/common"
+	"github.com/ccpgames/kube-solskin-controller/policy"
+	admission "k8s.io/api/admission/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const (
+	// InjectedAnnotation records the requests and limits injected into each
+	// container of a resource by the mutating webhook.
+	InjectedAnnotation = "solskin.io/injected-resources"
+
+	// DefaultsAnnotationPrefix prefixes the namespace annotations overriding
+	// the default profile, e.g. solskin.io/default-cpu-request.
+	DefaultsAnnotationPrefix = "solskin.io/default-"
+)
+
+// Profile is the set of default requests and limits injected into containers
+// that are missing them, keyed by e.g. requests.cpu.
+type Profile map[string]resource.Quantity
+
+// JSON patch operation, as defined by RFC 6902.
+type patchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// Mapping of the resource requirements we inject to their check and
+// configuration name.
+var injectable = []struct {
+	Check    string
+	Name     core.ResourceName
+	Setting  string
+	Fallback string
+}{
+	{"requests", core.ResourceCPU, "cpu-request", "100m"},
+	{"requests", core.ResourceMemory, "memory-request", "128Mi"},
+	{"limits", core.ResourceCPU, "cpu-limit", "500m"},
+	{"limits", core.ResourceMemory, "memory-limit", "256Mi"},
+}
+
+// Helper function to handle HTTP requests to the mutating webhook.
+func (s Service) serveMutate(w http.ResponseWriter, r *http.Request) {
+	serve(w, r, s.mutate)
+}
+
+// Helper function to determine if the mutating webhook is enabled.
+func (s Service) mutating() bool {
+	return s.Configuration.Get(s.GetSlug(), "mutate").Bool(false)
+}
+
+// Helper function to inject the default requests and limits into the
+// containers of the admitted resource that are missing them, for resources in
+// namespaces that have opted in to auto-fixing.
+func (s Service) mutate(req *admission.AdmissionRequest) *admission.AdmissionResponse {
+	allowed := &admission.AdmissionResponse{Allowed: true}
+
+	obj, err := decode(req, req.Object.Raw)
+	if err != nil {
+		log.Printf("could not decode %s admission request: %s", req.Kind.Kind, err)
+		return allowed
+	}
+	if obj == nil {
+		return allowed
+	}
+
+	m, _ := common.GetObjectMeta(obj)
+	if !s.isEligible(obj, m) {
+		return allowed
+	}
+	if value, _ := common.GetNamespaceSetting(m.Namespace, common.NamespaceAutofixLabel); value != "true" {
+		return allowed
+	}
+
+	profile := s.profile(m.Namespace)
+	include := policy.IncludeFunc(obj, s.Configuration)
+	spec := common.GetPodSpec(obj)
+	injected := map[string]map[string]string{}
+	for i := range spec.Containers {
+		// Containers ignored by a check don't get its values injected either.
+		name := spec.Containers[i].Name
+		includeContainer := func(check string) bool {
+			return include(check) && !common.IsContainerIgnored(s.Configuration, check, name)
+		}
+		if values := inject(&spec.Containers[i], profile, includeContainer); len(values) > 0 {
+			injected[spec.Containers[i].Name] = values
+		}
+	}
+	if len(injected) == 0 {
+		return allowed
+	}
+
+	patch, err := generatePatch(obj, m, spec, injected)
+	if err != nil {
+		log.Printf("[%s] could not generate patch: %s", common.GetFullLabel(obj), err)
+		return allowed
+	}
+
+	log.Printf("[%s] injecting default resources into %d container(s)", common.GetFullLabel(obj), len(injected))
+	patchType := admission.PatchTypeJSONPatch
+	return &admission.AdmissionResponse{Allowed: true, Patch: patch, PatchType: &patchType}
+}
+
+// Helper function to build the default profile of the namespace, where
+// namespace annotations take precedence over the service configuration.
+func (s Service) profile(namespace string) Profile {
+	profile := Profile{}
+	for _, i := range injectable {
+		key := fmt.Sprintf("%s.%s", i.Check, i.Name)
+		parts := append([]string{s.GetSlug(), "defaults"}, strings.Split(i.Setting, "-")...)
+		value := s.Configuration.Get(parts...).String(i.Fallback)
+		if v, ok := common.GetNamespaceSetting(namespace, DefaultsAnnotationPrefix+i.Setting); ok {
+			value = v
+		}
+
+		// An empty value disables injecting the requirement.
+		if value == "" {
+			continue
+		}
+
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			log.Printf("could not parse default %s of namespace [%s], value given: [%s]", key, namespace, value)
+			continue
+		}
+		profile[key] = quantity
+	}
+	return profile
+}
+
+// Helper function to fill in the missing requests and limits of a container
+// from the profile, returning what was injected. Injected requests never exceed
+// the container's limits, and injected limits are never below its requests.
+func inject(c *core.Container, profile Profile, include func(string) bool) map[string]string {
+	values := map[string]string{}
+	for _, i := range injectable {
+		key := fmt.Sprintf("%s.%s", i.Check, i.Name)
+		quantity, ok := profile[key]
+		if !ok || !include(i.Check) {
+			continue
+		}
+
+		switch i.Check {
+		case "requests":
+			if _, ok := c.Resources.Requests[i.Name]; ok {
+				continue
+			}
+			if limit, ok := c.Resources.Limits[i.Name]; ok && quantity.Cmp(limit) > 0 {
+				quantity = limit
+			}
+			if c.Resources.Requests == nil {
+				c.Resources.Requests = core.ResourceList{}
+			}
+			c.Resources.Requests[i.Name] = quantity
+		case "limits":
+			if _, ok := c.Resources.Limits[i.Name]; ok {
+				continue
+			}
+			if request, ok := c.Resources.Requests[i.Name]; ok && quantity.Cmp(request) < 0 {
+				quantity = request
+			}
+			if c.Resources.Limits == nil {
+				c.Resources.Limits = core.ResourceList{}
+			}
+			c.Resources.Limits[i.Name] = quantity
+		}
+		values[key] = quantity.String()
+	}
+	return values
+}
+
+// Helper function to generate the JSON patch replacing the containers of the
+// resource with their mutated version, and annotating the resource with what
+// was injected.
+func generatePatch(obj interface{}, m meta.ObjectMeta, spec *core.PodSpec, injected map[string]map[string]string) ([]byte, error) {
+	annotation, err := json.Marshal(injected)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := "/spec/template/spec"
+	if _, ktype := common.GetObjectMeta(obj); ktype == "pod" {
+		prefix = "/spec"
+	}
+
+	operations := []patchOperation{
+		patchOperation{
+			Op:    "replace",
+			Path:  prefix + "/containers",
+			Value: spec.Containers,
+		},
+	}
+
+	if m.Annotations == nil {
+		operations = append(operations, patchOperation{
+			Op:    "add",
+			Path:  "/metadata/annotations",
+			Value: map[string]string{InjectedAnnotation: string(annotation)},
+		})
+	} else {
+		operations = append(operations, patchOperation{
+			Op:    "add",
+			Path:  "/metadata/annotations/" + strings.Replace(InjectedAnnotation, "/", "~1", -1),
+			Value: string(annotation),
+		})
+	}
+
+	return json.Marshal(operations)
+}
@@ -0,0 +1,304 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ccpgames/kube-solskin-controller/common"
+	"github.com/ccpgames/kube-solskin-controller/leader"
+	"github.com/ccpgames/kube-solskin-controller/policy"
+	"github.com/ccpgames/kube-solskin-controller/queue"
+	"github.com/micro/go-config"
+	"github.com/prometheus/client_golang/prometheus"
+	admission "k8s.io/api/admission/v1"
+	apps "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Mode is an enumeration of how the webhook responds to resources that do not
+// meet standards.
+type Mode string
+
+const (
+	// ModeOff disables the webhook server entirely.
+	ModeOff Mode = "off"
+
+	// ModeDeny rejects resources that do not meet standards.
+	ModeDeny Mode = "deny"
+
+	// ModeWarn admits resources that do not meet standards, with a warning.
+	ModeWarn Mode = "warn"
+)
+
+var reviewsMetric = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Help: "Counter of admission reviews handled, by resource type and result.",
+		Name: "solskin_admission_reviews",
+	},
+	[]string{
+		"resource_type",
+		"result",
+	},
+)
+
+// Service is the base service for the webhook service.
+type Service struct {
+	Client        kubernetes.Interface
+	Configuration config.Config
+}
+
+// GetSlug returns the slug used for the configuration section.
+func (s Service) GetSlug() string {
+	return "webhook"
+}
+
+// GenerateEventHandlers returns all event handlers used by this service.
+func (s Service) GenerateEventHandlers() []queue.Handlers {
+	return []queue.Handlers{}
+}
+
+// Init registers prometheus metrics for the webhook service.
+func (s Service) Init() {
+	prometheus.MustRegister(reviewsMetric)
+}
+
+// Start will serve the admission webhooks over HTTPS, if enabled.
+func (s Service) Start() {
+	mode := s.mode()
+	mutating := s.mutating()
+	if mode == ModeOff && !mutating {
+		log.Println("admission webhooks disabled")
+		return
+	}
+
+	cslug := s.GetSlug()
+	port := s.Configuration.Get(cslug, "port").Int(8443)
+	cert := s.Configuration.Get(cslug, "cert").String("/etc/solskin/tls/tls.crt")
+	key := s.Configuration.Get(cslug, "key").String("/etc/solskin/tls/tls.key")
+
+	mux := http.NewServeMux()
+	if mode != ModeOff {
+		mux.HandleFunc("/validate", s.serveValidate)
+	}
+	if mutating {
+		mux.HandleFunc("/mutate", s.serveMutate)
+	}
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", port),
+		Handler: mux,
+	}
+
+	log.Printf("serving admission webhooks on port %d, validating: %s, mutating: %t", port, mode, mutating)
+	go func() {
+		if err := server.ListenAndServeTLS(cert, key); err != nil {
+			log.Printf("admission webhook server stopped: %s", err)
+		}
+	}()
+}
+
+// Helper function to determine the mode of the webhook, defaulting to off.
+func (s Service) mode() Mode {
+	mode := Mode(s.Configuration.Get(s.GetSlug(), "mode").String(string(ModeOff)))
+	switch mode {
+	case ModeOff, ModeDeny, ModeWarn:
+		return mode
+	}
+
+	log.Printf("invalid webhook mode [%s], defaulting to off", mode)
+	return ModeOff
+}
+
+// Helper function to determine the username we make requests to the API server
+// as, defaulting to the solskin service account of the namespace we're running
+// in.
+func (s Service) username() string {
+	fallback := fmt.Sprintf("system:serviceaccount:%s:solskin", leader.Namespace())
+	return s.Configuration.Get(s.GetSlug(), "username").String(fallback)
+}
+
+// Helper function to handle HTTP requests to the validating webhook.
+func (s Service) serveValidate(w http.ResponseWriter, r *http.Request) {
+	serve(w, r, s.validate)
+}
+
+// Helper function to decode an admission review from the request, pass it to
+// the handler and encode the resulting review as the response.
+func serve(w http.ResponseWriter, r *http.Request, handler func(*admission.AdmissionRequest) *admission.AdmissionResponse) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	review := admission.AdmissionReview{}
+	if err := json.NewDecoder(r.Body).Decode(&review); err != nil || review.Request == nil {
+		http.Error(w, "could not decode admission review", http.StatusBadRequest)
+		return
+	}
+
+	response := handler(review.Request)
+	response.UID = review.Request.UID
+	review.Request = nil
+	review.Response = response
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(review); err != nil {
+		log.Printf("could not encode admission review: %s", err)
+	}
+}
+
+// Helper function to validate the resource of an admission request against
+// every check that applies to it.
+func (s Service) validate(req *admission.AdmissionRequest) *admission.AdmissionResponse {
+	allowed := &admission.AdmissionResponse{Allowed: true}
+
+	// Our own changes, e.g. suppressing a resource that doesn't meet standards,
+	// are always admitted.
+	if req.UserInfo.Username == s.username() {
+		return allowed
+	}
+
+	obj, err := decode(req, req.Object.Raw)
+	if err != nil {
+		log.Printf("could not decode %s admission request: %s", req.Kind.Kind, err)
+		return allowed
+	}
+	if obj == nil {
+		return allowed
+	}
+
+	m, ktype := common.GetObjectMeta(obj)
+	if !s.isEligible(obj, m) {
+		return allowed
+	}
+
+	// Only checks that have the resource suppressed have it denied, failures of
+	// any other check are merely warned about. Updates are only denied for
+	// checks the resource met before, so that resources already failing them
+	// can still be changed, e.g. scaled down or fixed one check at a time.
+	previous := s.previousFailures(req)
+	failures := []string{}
+	reasons := []string{}
+	suppressing := false
+	for _, evaluation := range common.EvaluateChecks(obj, s.Configuration, policy.IncludeFunc(obj, s.Configuration)) {
+		if evaluation.Result.Passed {
+			continue
+		}
+		failures = append(failures, evaluation.Check.Name())
+		reasons = append(reasons, evaluation.Result.Reason)
+		name := evaluation.Check.Name()
+		suppressing = suppressing || (common.IsCheckSuppressing(name, s.Configuration) && !previous[name])
+	}
+
+	result := "allowed"
+	defer func() {
+		reviewsMetric.With(map[string]string{
+			"resource_type": ktype,
+			"result":        result,
+		}).Inc()
+	}()
+
+	if len(failures) == 0 {
+		return allowed
+	}
+
+	message := fmt.Sprintf(
+		"%s does not meet %s requirements: %s",
+		common.GetFullLabel(obj),
+		strings.Join(failures, ", "),
+		strings.Join(reasons, "; "),
+	)
+	log.Printf("[%s] admission review: %s", common.GetFullLabel(obj), message)
+
+	if s.mode() == ModeWarn || !suppressing {
+		result = "warned"
+		return &admission.AdmissionResponse{Allowed: true, Warnings: []string{message}}
+	}
+
+	result = "denied"
+	return &admission.AdmissionResponse{
+		Allowed: false,
+		Result: &meta.Status{
+			Status:  meta.StatusFailure,
+			Message: message,
+			Reason:  meta.StatusReasonForbidden,
+			Code:    http.StatusForbidden,
+		},
+	}
+}
+
+// Helper function to determine the checks the resource failed before it was
+// updated, which is none for any other operation.
+func (s Service) previousFailures(req *admission.AdmissionRequest) map[string]bool {
+	failures := map[string]bool{}
+	if req.Operation != admission.Update {
+		return failures
+	}
+
+	old, err := decode(req, req.OldObject.Raw)
+	if err != nil || old == nil {
+		log.Printf("could not decode previous %s of admission request: %v", req.Kind.Kind, err)
+		return failures
+	}
+
+	for _, evaluation := range common.EvaluateChecks(old, s.Configuration, policy.IncludeFunc(old, s.Configuration)) {
+		if !evaluation.Result.Passed {
+			failures[evaluation.Check.Name()] = true
+		}
+	}
+	return failures
+}
+
+// Helper function to determine if the admitted resource should be validated.
+// Pods with a controller are skipped, as their controller has already been
+// validated when it was admitted.
+func (s Service) isEligible(obj interface{}, m meta.ObjectMeta) bool {
+	if common.IsExempt(obj, s.Configuration) {
+		return false
+	}
+
+	if _, ktype := common.GetObjectMeta(obj); ktype == "pod" && meta.GetControllerOf(&m) != nil {
+		return false
+	}
+
+	return common.IsEligibleNamespace(m.Namespace, s.Configuration)
+}
+
+// Helper function to decode the given resource of an admission request, its
+// object or old object, returning nil for kinds of resources we don't validate.
+func decode(req *admission.AdmissionRequest, raw []byte) (interface{}, error) {
+	obj, err := common.DecodeObject(req.Kind.Kind, raw)
+	if err != nil || obj == nil {
+		return nil, err
+	}
+
+	// Resources don't necessarily have their namespace set when created, so
+	// fill it in from the request.
+	m, _ := common.GetObjectMeta(obj)
+	if m.Namespace == "" {
+		setNamespace(obj, req.Namespace)
+	}
+	return obj, nil
+}
+
+// Helper function to set the namespace of a decoded resource.
+func setNamespace(obj interface{}, namespace string) {
+	switch o := obj.(type) {
+	case *core.Pod:
+		o.Namespace = namespace
+	case *apps.Deployment:
+		o.Namespace = namespace
+	case *apps.DaemonSet:
+		o.Namespace = namespace
+	case *apps.StatefulSet:
+		o.Namespace = namespace
+	case *apps.ReplicaSet:
+		o.Namespace = namespace
+	case *batch.Job:
+		o.Namespace = namespace
+	}
+}
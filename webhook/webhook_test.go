@@ -0,0 +1,334 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/ccpgames/kube-solskin-controller/common"
+	"github.com/ccpgames/kube-solskin-controller/exporter"
+	"github.com/evanphx/json-patch"
+	"github.com/micro/go-config"
+	"github.com/micro/go-config/source/env"
+	"github.com/stretchr/testify/assert"
+	admission "k8s.io/api/admission/v1"
+	apps "k8s.io/api/apps/v1"
+	authentication "k8s.io/api/authentication/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func compliantPodSpec() core.PodSpec {
+	quantity := *resource.NewScaledQuantity(1, resource.Mega)
+	return core.PodSpec{
+		Containers: []core.Container{
+			core.Container{
+				Name: "app",
+				LivenessProbe: &core.Probe{
+					ProbeHandler: core.ProbeHandler{Exec: &core.ExecAction{}},
+				},
+				ReadinessProbe: &core.Probe{
+					ProbeHandler: core.ProbeHandler{Exec: &core.ExecAction{}},
+				},
+				Resources: core.ResourceRequirements{
+					Requests: core.ResourceList{
+						core.ResourceCPU:    quantity,
+						core.ResourceMemory: quantity,
+					},
+					Limits: core.ResourceList{
+						core.ResourceCPU:    quantity,
+						core.ResourceMemory: quantity,
+					},
+				},
+			},
+		},
+	}
+}
+
+func request(t *testing.T, kind string, obj interface{}) *admission.AdmissionRequest {
+	raw, err := json.Marshal(obj)
+	assert.Nil(t, err)
+	return &admission.AdmissionRequest{
+		UID:       "1234",
+		Kind:      meta.GroupVersionKind{Kind: kind},
+		Namespace: "default",
+		Operation: admission.Create,
+		Object:    runtime.RawExtension{Raw: raw},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	controller := true
+	compliant := &apps.Deployment{
+		Spec: apps.DeploymentSpec{
+			Template: core.PodTemplateSpec{
+				ObjectMeta: meta.ObjectMeta{
+					Annotations: map[string]string{"prometheus.io/scrape": "true"},
+				},
+				Spec: compliantPodSpec(),
+			},
+		},
+	}
+
+	tests := []struct {
+		Kind     string
+		Resource interface{}
+		Allowed  bool
+	}{
+		// Deployment meeting all standards.
+		{Kind: "Deployment", Resource: compliant, Allowed: true},
+
+		// Deployment without any standards.
+		{Kind: "Deployment", Resource: &apps.Deployment{}, Allowed: false},
+
+		// Pod without any standards.
+		{Kind: "Pod", Resource: &core.Pod{}, Allowed: false},
+
+		// Pod without any standards, managed by a controller.
+		{
+			Kind: "Pod",
+			Resource: &core.Pod{ObjectMeta: meta.ObjectMeta{
+				OwnerReferences: []meta.OwnerReference{
+					meta.OwnerReference{Kind: "ReplicaSet", Name: "rs", Controller: &controller},
+				},
+			}},
+			Allowed: true,
+		},
+
+		// Exempted pod without any standards.
+		{
+			Kind: "Pod",
+			Resource: &core.Pod{ObjectMeta: meta.ObjectMeta{
+				Annotations: map[string]string{"solskin.io/exempt": "true"},
+			}},
+			Allowed: true,
+		},
+
+		// Pod in an excluded namespace.
+		{
+			Kind:     "Pod",
+			Resource: &core.Pod{ObjectMeta: meta.ObjectMeta{Namespace: "kube-system"}},
+			Allowed:  true,
+		},
+
+		// Kinds of resources we don't validate.
+		{Kind: "ConfigMap", Resource: &core.ConfigMap{}, Allowed: true},
+	}
+
+	os.Setenv("SOLSKIN_WEBHOOK_MODE", "deny")
+	defer os.Unsetenv("SOLSKIN_WEBHOOK_MODE")
+	cfg := config.NewConfig()
+	cfg.Load(env.NewSource(env.WithStrippedPrefix("SOLSKIN")))
+	s := Service{Configuration: cfg}
+
+	for _, test := range tests {
+		response := s.validate(request(t, test.Kind, test.Resource))
+		assert.Exactly(t, test.Allowed, response.Allowed, test.Kind)
+		if !test.Allowed {
+			assert.Exactly(t, int32(http.StatusForbidden), response.Result.Code)
+		}
+	}
+}
+
+func TestValidateOwnRequests(t *testing.T) {
+	os.Setenv("SOLSKIN_WEBHOOK_MODE", "deny")
+	os.Setenv("SOLSKIN_WEBHOOK_USERNAME", "system:serviceaccount:solskin:controller")
+	defer os.Unsetenv("SOLSKIN_WEBHOOK_MODE")
+	defer os.Unsetenv("SOLSKIN_WEBHOOK_USERNAME")
+	cfg := config.NewConfig()
+	cfg.Load(env.NewSource(env.WithStrippedPrefix("SOLSKIN")))
+	s := Service{Configuration: cfg}
+
+	// Requests made by anyone else are validated as usual.
+	req := request(t, "Deployment", &apps.Deployment{})
+	req.Operation = admission.Update
+	req.UserInfo = authentication.UserInfo{Username: "system:serviceaccount:solskin:other"}
+	assert.False(t, s.validate(req).Allowed)
+
+	// Our own requests, e.g. suppressing the deployment, are admitted.
+	req.UserInfo = authentication.UserInfo{Username: "system:serviceaccount:solskin:controller"}
+	assert.True(t, s.validate(req).Allowed)
+}
+
+func TestValidateComplianceAnnotation(t *testing.T) {
+	os.Setenv("SOLSKIN_WEBHOOK_MODE", "deny")
+	defer os.Unsetenv("SOLSKIN_WEBHOOK_MODE")
+	cfg := config.NewConfig()
+	cfg.Load(env.NewSource(env.WithStrippedPrefix("SOLSKIN")))
+	s := Service{Configuration: cfg}
+
+	// The exporter recording the results of a subpar deployment on it must not
+	// be denied, or the annotation could never be written.
+	deployment := &apps.Deployment{ObjectMeta: meta.ObjectMeta{
+		Name:        "app",
+		Annotations: map[string]string{exporter.ComplianceAnnotation: `{"checks":[]}`},
+	}}
+	req := request(t, "Deployment", deployment)
+	req.Operation = admission.Update
+	req.UserInfo = authentication.UserInfo{Username: s.username()}
+	assert.True(t, s.validate(req).Allowed)
+
+	// While the same update by anyone else is.
+	req.UserInfo = authentication.UserInfo{Username: "jane"}
+	assert.False(t, s.validate(req).Allowed)
+}
+
+func TestValidateWarn(t *testing.T) {
+	os.Setenv("SOLSKIN_WEBHOOK_MODE", "warn")
+	defer os.Unsetenv("SOLSKIN_WEBHOOK_MODE")
+	cfg := config.NewConfig()
+	cfg.Load(env.NewSource(env.WithStrippedPrefix("SOLSKIN")))
+	s := Service{Configuration: cfg}
+
+	response := s.validate(request(t, "Pod", &core.Pod{}))
+	assert.True(t, response.Allowed)
+	assert.Len(t, response.Warnings, 1)
+	assert.Nil(t, response.Result)
+}
+
+func TestValidateNotSuppressing(t *testing.T) {
+	os.Setenv("SOLSKIN_WEBHOOK_MODE", "deny")
+	os.Setenv("SOLSKIN_CHECKS_LIVENESS_SUPPRESS", "false")
+	defer os.Unsetenv("SOLSKIN_WEBHOOK_MODE")
+	defer os.Unsetenv("SOLSKIN_CHECKS_LIVENESS_SUPPRESS")
+	cfg := config.NewConfig()
+	cfg.Load(env.NewSource(env.WithStrippedPrefix("SOLSKIN")))
+	s := Service{Configuration: cfg}
+
+	// Failing a check that doesn't suppress only warns.
+	spec := compliantPodSpec()
+	spec.Containers[0].LivenessProbe = nil
+	pod := &core.Pod{
+		ObjectMeta: meta.ObjectMeta{Annotations: map[string]string{"prometheus.io/scrape": "true"}},
+		Spec:       spec,
+	}
+	response := s.validate(request(t, "Pod", pod))
+	assert.True(t, response.Allowed)
+	assert.Len(t, response.Warnings, 1)
+
+	// Failing any other check along with it still denies.
+	pod.Spec.Containers[0].ReadinessProbe = nil
+	response = s.validate(request(t, "Pod", pod))
+	assert.False(t, response.Allowed)
+}
+
+func TestValidateUpdate(t *testing.T) {
+	os.Setenv("SOLSKIN_WEBHOOK_MODE", "deny")
+	defer os.Unsetenv("SOLSKIN_WEBHOOK_MODE")
+	cfg := config.NewConfig()
+	cfg.Load(env.NewSource(env.WithStrippedPrefix("SOLSKIN")))
+	s := Service{Configuration: cfg}
+
+	compliant := &apps.Deployment{ObjectMeta: meta.ObjectMeta{
+		Name:        "app",
+		Annotations: map[string]string{"prometheus.io/scrape": "true"},
+	}}
+	compliant.Spec.Template.Spec = compliantPodSpec()
+	subpar := compliant.DeepCopy()
+	subpar.Spec.Template.Spec.Containers[0].LivenessProbe = nil
+
+	// Changing a deployment that already fails a check is only warned about.
+	replicas := int32(0)
+	scaled := subpar.DeepCopy()
+	scaled.Spec.Replicas = &replicas
+	req := request(t, "Deployment", scaled)
+	req.Operation = admission.Update
+	req.OldObject = request(t, "Deployment", subpar).Object
+	response := s.validate(req)
+	assert.True(t, response.Allowed)
+	assert.Len(t, response.Warnings, 1)
+
+	// While an update introducing the failure is denied.
+	req = request(t, "Deployment", subpar)
+	req.Operation = admission.Update
+	req.OldObject = request(t, "Deployment", compliant).Object
+	assert.False(t, s.validate(req).Allowed)
+}
+
+func TestServe(t *testing.T) {
+	s := Service{Configuration: config.NewConfig()}
+	review := admission.AdmissionReview{
+		TypeMeta: meta.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+		Request:  request(t, "Pod", &core.Pod{}),
+	}
+	body, err := json.Marshal(review)
+	assert.Nil(t, err)
+
+	recorder := httptest.NewRecorder()
+	s.serveValidate(recorder, httptest.NewRequest(http.MethodPost, "/validate", bytes.NewReader(body)))
+	assert.Exactly(t, http.StatusOK, recorder.Code)
+
+	result := admission.AdmissionReview{}
+	assert.Nil(t, json.NewDecoder(recorder.Body).Decode(&result))
+	assert.Exactly(t, review.TypeMeta, result.TypeMeta)
+	assert.Nil(t, result.Request)
+	assert.Exactly(t, types.UID("1234"), result.Response.UID)
+
+	recorder = httptest.NewRecorder()
+	s.serveValidate(recorder, httptest.NewRequest(http.MethodPost, "/validate", bytes.NewReader([]byte("{}"))))
+	assert.Exactly(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestMutate(t *testing.T) {
+	common.SetNamespace(&core.Namespace{ObjectMeta: meta.ObjectMeta{
+		Name:        "autofix",
+		Labels:      map[string]string{common.NamespaceAutofixLabel: "true"},
+		Annotations: map[string]string{DefaultsAnnotationPrefix + "memory-limit": "1Gi"},
+	}})
+	defer common.DeleteNamespace("autofix")
+
+	s := Service{Configuration: config.NewConfig()}
+	quantity := resource.MustParse("50m")
+	deployment := &apps.Deployment{
+		ObjectMeta: meta.ObjectMeta{Name: "app", Namespace: "autofix"},
+		Spec: apps.DeploymentSpec{
+			Template: core.PodTemplateSpec{
+				Spec: core.PodSpec{
+					Containers: []core.Container{
+						core.Container{
+							Name: "app",
+							Resources: core.ResourceRequirements{
+								Limits: core.ResourceList{core.ResourceCPU: quantity},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	// Namespaces that have not opted in are left alone.
+	unchanged := deployment.DeepCopy()
+	unchanged.Namespace = "default"
+	response := s.mutate(request(t, "Deployment", unchanged))
+	assert.True(t, response.Allowed)
+	assert.Nil(t, response.Patch)
+
+	req := request(t, "Deployment", deployment)
+	response = s.mutate(req)
+	assert.True(t, response.Allowed)
+	assert.NotNil(t, response.Patch)
+
+	patch, err := jsonpatch.DecodePatch(response.Patch)
+	assert.Nil(t, err)
+	raw, err := patch.Apply(req.Object.Raw)
+	assert.Nil(t, err)
+
+	mutated := &apps.Deployment{}
+	assert.Nil(t, json.Unmarshal(raw, mutated))
+	resources := mutated.Spec.Template.Spec.Containers[0].Resources
+	assert.Exactly(t, "50m", resources.Requests.Cpu().String())
+	assert.Exactly(t, "128Mi", resources.Requests.Memory().String())
+	assert.Exactly(t, "50m", resources.Limits.Cpu().String())
+	assert.Exactly(t, "1Gi", resources.Limits.Memory().String())
+	assert.Exactly(
+		t,
+		`{"app":{"limits.memory":"1Gi","requests.cpu":"50m","requests.memory":"128Mi"}}`,
+		mutated.Annotations[InjectedAnnotation],
+	)
+}